@@ -20,7 +20,6 @@ import {
 	LightningBoltIcon,
 	BarChartIcon,
 	GearIcon,
-	PlayIcon,
 	GitHubLogoIcon,
 	ExternalLinkIcon,
 	StarIcon,
@@ -565,34 +564,14 @@ function CryptoDashboard() {
 
 	const { data, isLoading, error, refetch, isRefetching } = useCryptoData();
 
-	const triggerManualFetch = async () => {
-		try {
-			const API_BASE_URL =
-				process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
-			const response = await fetch(`${API_BASE_URL}/dev/trigger`, {
-				method: 'POST',
-				headers: { 'Content-Type': 'application/json' },
-			});
-
-			if (response.ok) {
-				setToastMessage({
-					title: 'Data fetch triggered',
-					description: 'Fresh data will be available in ~30 seconds',
-					type: 'success',
-				});
-				setToastOpen(true);
-
-				// Refetch after a delay
-				setTimeout(() => {
-					refetch();
-				}, 2000);
-			} else {
-				throw new Error('Failed to trigger fetch');
-			}
-		} catch (err) {
+	// Refetch the stored data. Starting a new run (/dev/trigger) needs an admin
+	// key, which must never be shipped to the browser, so it isn't offered here.
+	const refreshData = async () => {
+		const result = await refetch();
+		if (result.error) {
 			setToastMessage({
-				title: 'Trigger failed',
-				description: `Unable to trigger manual data fetch: ${err}`,
+				title: 'Refresh failed',
+				description: `Unable to load crypto data: ${result.error.message}`,
 				type: 'error',
 			});
 			setToastOpen(true);
@@ -931,7 +910,7 @@ function CryptoDashboard() {
 
 									<div className='action-buttons'>
 										<button
-											onClick={() => refetch()}
+											onClick={refreshData}
 											disabled={isRefetching}
 											className='btn btn-secondary'>
 											{isRefetching ? (
@@ -941,12 +920,6 @@ function CryptoDashboard() {
 											)}
 											Refresh
 										</button>
-										<button
-											onClick={triggerManualFetch}
-											className='btn btn-primary'>
-											<PlayIcon className='w-4 h-4' />
-											Trigger
-										</button>
 									</div>
 
 									{data && (
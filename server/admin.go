@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Admin routes (/dev/*) need a key from ADMIN_API_KEYS, a comma-separated
+// list of name:key pairs. The name identifies the caller in cooldowns and the
+// audit log. With no keys configured admin routes are refused, unless
+// ADMIN_AUTH_DISABLED=true opens them for local development.
+//
+// Failed authentication is logged apart from the audit log, so it can't push
+// real admin actions out. An IP that fails ADMIN_AUTH_MAX_FAILURES times
+// within ADMIN_AUTH_LOCKOUT gets 429 instead of 401/403 for that long; a valid
+// key still gets through, so a locked-out admin can't be kept out.
+const (
+	adminCooldownPrefix    = "crypto:admin:cooldown:"
+	adminAuditKey          = "crypto:admin:audit"
+	adminAuthFailuresKey   = "crypto:admin:auth_failures"
+	adminAuditMax          = 1000
+	adminMinKeyLength      = 16
+	adminAuthFailurePrefix = "crypto:ratelimit:admin:" // Sliding window of failures per client IP
+	adminAuthLockoutPrefix = "crypto:admin:lockout:"   // Unix time the IP's lockout ends
+
+	adminCallerKey = "admin_caller"
+	adminDetailKey = "admin_detail"
+)
+
+type adminKey struct {
+	name string
+	hash [sha256.Size]byte
+}
+
+var (
+	adminKeys         []adminKey
+	adminAuthDisabled bool
+	triggerCooldown   = time.Minute // TRIGGER_COOLDOWN
+
+	adminAuthMaxFailures = 10               // ADMIN_AUTH_MAX_FAILURES
+	adminAuthLockout     = 15 * time.Minute // ADMIN_AUTH_LOCKOUT, also the window failures are counted in
+)
+
+// AdminAuditEntry is one admin request, allowed or not
+type AdminAuditEntry struct {
+	Time     time.Time   `json:"time"`
+	Caller   string      `json:"caller"` // Empty when authentication failed
+	Action   string      `json:"action"`
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	ClientIP string      `json:"client_ip"`
+	Status   int         `json:"status"`
+	Detail   interface{} `json:"detail,omitempty"`
+}
+
+func initAdminAuth() {
+	adminAuthDisabled = os.Getenv("ADMIN_AUTH_DISABLED") == "true"
+	triggerCooldown = durationFromEnv("TRIGGER_COOLDOWN", triggerCooldown)
+	adminAuthMaxFailures = intFromEnv("ADMIN_AUTH_MAX_FAILURES", adminAuthMaxFailures)
+	adminAuthLockout = durationFromEnv("ADMIN_AUTH_LOCKOUT", adminAuthLockout)
+
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(os.Getenv("ADMIN_API_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok || name == "" {
+			log.Fatalf("Invalid ADMIN_API_KEYS entry: expected name:key")
+		}
+		if len(key) < adminMinKeyLength {
+			log.Fatalf("Invalid ADMIN_API_KEYS entry for %q: key must be at least %d characters", name, adminMinKeyLength)
+		}
+		if seen[name] {
+			log.Fatalf("Invalid ADMIN_API_KEYS: duplicate name %q", name)
+		}
+		seen[name] = true
+		adminKeys = append(adminKeys, adminKey{name: name, hash: sha256.Sum256([]byte(key))})
+	}
+
+	switch {
+	case adminAuthDisabled:
+		log.Printf("⚠️  ADMIN_AUTH_DISABLED=true: admin routes are open to anyone")
+	case len(adminKeys) == 0:
+		log.Printf("ℹ️  No ADMIN_API_KEYS configured, admin routes are disabled")
+	default:
+		log.Printf("✅ Admin auth: %d API keys, trigger cooldown %s", len(adminKeys), triggerCooldown)
+	}
+}
+
+// Key from "Authorization: Bearer <key>" or "X-API-Key: <key>"
+func requestAPIKey(c *gin.Context) string {
+	if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(bearer)
+	}
+	return c.GetHeader("X-API-Key")
+}
+
+// Name of the admin the key belongs to. Every key is compared, in constant time.
+func adminForKey(key string) (string, bool) {
+	hash := sha256.Sum256([]byte(key))
+	name := ""
+	for _, k := range adminKeys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[:]) == 1 {
+			name = k.name
+		}
+	}
+	return name, name != ""
+}
+
+// Caller set by requireAdmin
+func adminCaller(c *gin.Context) string {
+	return c.GetString(adminCallerKey)
+}
+
+// requireAdmin rejects requests without a valid admin key and records the
+// caller for the middleware and handlers after it
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminAuthDisabled {
+			c.Set(adminCallerKey, "anonymous")
+			c.Next()
+			return
+		}
+		if len(adminKeys) == 0 {
+			c.AbortWithStatusJSON(503, gin.H{"error": "Admin access is not configured"})
+			return
+		}
+
+		// A valid key always gets through; only failed attempts are throttled
+		key := requestAPIKey(c)
+		caller, ok := adminForKey(key)
+		if !ok {
+			if retryAfter, locked := adminAuthLockedOut(c.Request.Context(), c.ClientIP()); locked {
+				c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+				c.AbortWithStatusJSON(429, gin.H{"error": "Too many failed admin authentication attempts", "retry_after": retryAfter})
+				return
+			}
+			status := 401
+			if key != "" {
+				status = 403
+			}
+			if adminAuthFailed(c, status) {
+				retryAfter := int64(adminAuthLockout.Seconds())
+				c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+				c.AbortWithStatusJSON(429, gin.H{"error": "Too many failed admin authentication attempts", "retry_after": retryAfter})
+				return
+			}
+			c.AbortWithStatusJSON(status, gin.H{"error": "Valid admin API key required"})
+			return
+		}
+		c.Set(adminCallerKey, caller)
+		c.Next()
+	}
+}
+
+// Seconds left on the client's lockout; false when it isn't locked out
+func adminAuthLockedOut(ctx context.Context, ip string) (int64, bool) {
+	value, err := store.Get(ctx, adminAuthLockoutPrefix+ip)
+	if err != nil {
+		return 0, false
+	}
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || unix <= time.Now().Unix() {
+		return 0, false
+	}
+	return unix - time.Now().Unix(), true
+}
+
+// Log a failed attempt and count it against the client IP. True when this
+// attempt used up the allowance and the IP is now locked out.
+func adminAuthFailed(c *gin.Context, status int) bool {
+	ctx := c.Request.Context()
+	ip := c.ClientIP()
+	log.Printf("🚫 Admin auth failed for %s %s from %s", c.Request.Method, c.Request.URL.Path, ip)
+	recordAdminEntry(adminAuthFailuresKey, newAdminAuditEntry(c, "auth", status))
+
+	result, err := store.SlidingWindowAllow(ctx, adminAuthFailurePrefix+ip, adminAuthMaxFailures, adminAuthLockout)
+	if err != nil {
+		log.Printf("⚠️  Failed to count admin auth failure for %s: %v", ip, err)
+		return false
+	}
+	if result.Allowed {
+		return false
+	}
+
+	until := strconv.FormatInt(time.Now().Add(adminAuthLockout).Unix(), 10)
+	if err := store.Set(ctx, adminAuthLockoutPrefix+ip, until, adminAuthLockout); err != nil {
+		log.Printf("⚠️  Failed to lock out %s: %v", ip, err)
+	}
+	log.Printf("🔒 %s locked out of admin routes for %s after %d failed attempts", ip, adminAuthLockout, adminAuthMaxFailures)
+	entry := newAdminAuditEntry(c, "auth-lockout", 429)
+	entry.Detail = gin.H{"failures": adminAuthMaxFailures, "lockout": adminAuthLockout.String()}
+	recordAdminAudit(entry)
+	return true
+}
+
+// adminCooldown allows one successful request per caller and action every d.
+// Requests that fail (4xx/5xx) give the slot back.
+func adminCooldown(action string, d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key := adminCooldownPrefix + action + ":" + adminCaller(c)
+		until := strconv.FormatInt(time.Now().Add(d).Unix(), 10)
+		claimed, err := store.SetNX(ctx, key, until, d)
+		if err != nil {
+			log.Printf("⚠️  Admin cooldown check failed for %s: %v", key, err)
+			claimed = true
+		}
+		if !claimed {
+			retryAfter := int64(d.Seconds())
+			if value, err := store.Get(ctx, key); err == nil {
+				if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+					retryAfter = max(unix-time.Now().Unix(), 1)
+				}
+			}
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			c.AbortWithStatusJSON(429, gin.H{
+				"error":       "Cooldown in effect for " + action,
+				"retry_after": retryAfter,
+			})
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= 400 {
+			if _, err := store.CompareAndDelete(context.Background(), key, until); err != nil {
+				log.Printf("⚠️  Failed to release admin cooldown %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// auditAdmin records the request and its outcome once the handler has run.
+// Handlers can attach detail with c.Set(adminDetailKey, ...).
+func auditAdmin(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		entry := newAdminAuditEntry(c, action, c.Writer.Status())
+		entry.Caller = adminCaller(c)
+		entry.Detail, _ = c.Get(adminDetailKey)
+		log.Printf("📝 Admin %s by %s: %d", action, entry.Caller, entry.Status)
+		recordAdminAudit(entry)
+	}
+}
+
+func newAdminAuditEntry(c *gin.Context, action string, status int) AdminAuditEntry {
+	return AdminAuditEntry{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Method:   c.Request.Method,
+		Path:     c.Request.URL.Path,
+		ClientIP: c.ClientIP(),
+		Status:   status,
+	}
+}
+
+func recordAdminAudit(entry AdminAuditEntry) {
+	recordAdminEntry(adminAuditKey, entry)
+}
+
+// Push to one of the admin logs (adminAuditKey or adminAuthFailuresKey)
+func recordAdminEntry(key string, entry AdminAuditEntry) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := store.LPushTrim(context.Background(), key, adminAuditMax, string(raw)); err != nil {
+		log.Printf("❌ Failed to record admin audit entry: %v", err)
+	}
+}
+
+// Most recent entries of one of the admin logs, newest first
+func getAdminAudit(key string, limit int) ([]AdminAuditEntry, error) {
+	values, err := store.LRange(context.Background(), key, 0, limit-1)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AdminAuditEntry, 0, len(values))
+	for _, value := range values {
+		var entry AdminAuditEntry
+		if err := json.Unmarshal([]byte(value), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
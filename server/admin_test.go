@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAdminLockoutOnlyThrottlesFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store = newFailoverStore(nil)
+	defer func(keys []adminKey, failures int) { adminKeys, adminAuthMaxFailures = keys, failures }(adminKeys, adminAuthMaxFailures)
+	adminKeys = []adminKey{{name: "ops", hash: sha256.Sum256([]byte("correct-horse-battery"))}}
+	adminAuthMaxFailures = 2
+
+	r := gin.New()
+	r.GET("/dev/audit", requireAdmin(), auditAdmin("view-audit"), func(c *gin.Context) { c.Status(200) })
+	request := func(key string) int {
+		req := httptest.NewRequest("GET", "/dev/audit", nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i, want := range []int{403, 403, 429, 429} {
+		if got := request("wrong-key-guess-000"); got != want {
+			t.Errorf("failed attempt %d: status %d, want %d", i+1, got, want)
+		}
+	}
+	if got := request("correct-horse-battery"); got != 200 {
+		t.Errorf("valid key during a lockout: status %d, want 200", got)
+	}
+
+	entries, err := getAdminAudit(adminAuditKey, 10)
+	if err != nil || len(entries) == 0 || entries[0].Action != "view-audit" || entries[0].Caller != "ops" {
+		t.Errorf("audit log %+v, %v: want the read recorded", entries, err)
+	}
+}
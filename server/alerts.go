@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Alert conditions. Value conditions compare raw_value with Threshold; top
+// conditions treat Threshold as a rank (e.g. 3 = top 3); rank_up/rank_down
+// fire when a coin moves at least Threshold places since the previous run.
+const (
+	ConditionValueAbove = "value_above"
+	ConditionValueBelow = "value_below"
+	ConditionEntersTop  = "enters_top"
+	ConditionLeavesTop  = "leaves_top"
+	ConditionRankUp     = "rank_up"
+	ConditionRankDown   = "rank_down"
+)
+
+const (
+	alertCooldownPrefix = "crypto:alerts:cooldown:"
+	alertRecentKey      = "crypto:alerts:recent"
+	alertRecentMax      = 200
+)
+
+var defaultAlertCooldown = time.Hour
+
+// AlertRule is one entry in the rules file (ALERT_RULES_FILE)
+type AlertRule struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name,omitempty"`
+	Metric    string  `json:"metric"`
+	Symbol    string  `json:"symbol,omitempty"` // Empty matches any coin
+	Condition string  `json:"condition"`
+	Threshold float64 `json:"threshold"`
+	Cooldown  string  `json:"cooldown,omitempty"` // Default 1h
+
+	cooldown time.Duration
+}
+
+type AlertRuleFile struct {
+	Rules []AlertRule `json:"rules"`
+}
+
+// Alert is a rule that matched one coin in one run
+type Alert struct {
+	RuleID       string    `json:"rule_id"`
+	RuleName     string    `json:"rule_name,omitempty"`
+	Metric       string    `json:"metric"`
+	Condition    string    `json:"condition"`
+	Threshold    float64   `json:"threshold"`
+	ID           int       `json:"id,omitempty"` // Coin ID
+	Symbol       string    `json:"symbol"`
+	Name         string    `json:"name"`
+	Value        string    `json:"value,omitempty"`
+	RawValue     *float64  `json:"raw_value,omitempty"`
+	Rank         int       `json:"rank,omitempty"`
+	PreviousRank int       `json:"previous_rank,omitempty"`
+	Message      string    `json:"message"`
+	FiredAt      time.Time `json:"fired_at"`
+}
+
+// AlertCoin is a coin fetched during a run, cut down to the values the value
+// rules look at. Value rules run over every fetched coin, not just the coins
+// that made a metric's stored ranking.
+type AlertCoin struct {
+	ID     int                `json:"id"`
+	Symbol string             `json:"symbol"`
+	Name   string             `json:"name"`
+	Values map[string]float64 `json:"values"` // By metric key; missing when LunarCrush didn't report it
+}
+
+// Loaded alert rules
+var alertRules []AlertRule
+
+func loadAlertRules() {
+	path := os.Getenv("ALERT_RULES_FILE")
+	if path == "" {
+		path = "alerts.json"
+	}
+
+	rules, err := readAlertRules(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("ℹ️  No alert rules file at %s, alerting disabled", path)
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid alert rules: ", err)
+	}
+
+	alertRules = rules
+	log.Printf("✅ Loaded %d alert rules from %s", len(rules), path)
+}
+
+func readAlertRules(path string) ([]AlertRule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file AlertRuleFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(file.Rules))
+	for i := range file.Rules {
+		rule := &file.Rules[i]
+		if err := validateAlertRule(rule); err != nil {
+			return nil, fmt.Errorf("%s: rule %d (%q): %w", path, i, rule.ID, err)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("%s: duplicate rule id %q", path, rule.ID)
+		}
+		seen[rule.ID] = true
+	}
+	return file.Rules, nil
+}
+
+func validateAlertRule(rule *AlertRule) error {
+	if rule.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if _, exists := sortableMetrics()[rule.Metric]; !exists {
+		return fmt.Errorf("unknown metric %q", rule.Metric)
+	}
+
+	switch rule.Condition {
+	case ConditionValueAbove, ConditionValueBelow:
+	case ConditionEntersTop, ConditionLeavesTop, ConditionRankUp, ConditionRankDown:
+		if rule.Threshold < 1 {
+			return fmt.Errorf("%s needs a threshold of at least 1", rule.Condition)
+		}
+	default:
+		return fmt.Errorf("unknown condition %q", rule.Condition)
+	}
+
+	rule.Symbol = strings.ToUpper(rule.Symbol)
+	rule.cooldown = defaultAlertCooldown
+	if rule.Cooldown != "" {
+		d, err := parseDurationWithDays(rule.Cooldown)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid cooldown %q", rule.Cooldown)
+		}
+		rule.cooldown = d
+	}
+	return nil
+}
+
+// Reduce fetched coins to what the loaded value rules need; nil when there
+// are none, so runs without them don't carry the coins around
+func alertCoins(coins []LunarCrushCoin) []AlertCoin {
+	registry := sortableMetrics()
+	metrics := map[string]MetricConfig{}
+	for _, rule := range alertRules {
+		if rule.Condition == ConditionValueAbove || rule.Condition == ConditionValueBelow {
+			if config, exists := registry[rule.Metric]; exists {
+				metrics[rule.Metric] = config
+			}
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	result := make([]AlertCoin, 0, len(coins))
+	for _, coin := range coins {
+		alertCoin := AlertCoin{ID: coin.ID, Symbol: coin.Symbol, Name: coin.Name, Values: map[string]float64{}}
+		for sortType, config := range metrics {
+			if value, ok := coin.fieldValue(config.Field); ok {
+				alertCoin.Values[sortType] = value
+			}
+		}
+		result = append(result, alertCoin)
+	}
+	return result
+}
+
+// One entry per coin; the same coin is fetched once for every metric it ranks in
+func uniqueAlertCoins(coins []AlertCoin) []AlertCoin {
+	seen := make(map[string]bool, len(coins))
+	unique := make([]AlertCoin, 0, len(coins))
+	for _, coin := range coins {
+		key := "id:" + strconv.Itoa(coin.ID)
+		if coin.ID == 0 {
+			key = "symbol:" + coin.Symbol
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, coin)
+		}
+	}
+	return unique
+}
+
+// Evaluate every rule against one run. Value rules run over the coins fetched
+// in the run; rank conditions rely on the MetricData.Changes computed against
+// the previous run.
+func evaluateAlertRules(rules []AlertRule, data CryptoDataResponse, coins []AlertCoin) []Alert {
+	coins = uniqueAlertCoins(coins)
+	var alerts []Alert
+	for _, rule := range rules {
+		metricData := data.AllMetrics[rule.Metric]
+		switch rule.Condition {
+		case ConditionValueAbove, ConditionValueBelow:
+			alerts = append(alerts, evaluateValueRule(rule, metricData, coins, data.Timestamp)...)
+		default:
+			if !metricData.Success || metricData.Stale {
+				continue // Stale data was already evaluated when it was fresh
+			}
+			alerts = append(alerts, evaluateRankRule(rule, metricData, data.Timestamp)...)
+		}
+	}
+	return alerts
+}
+
+func newAlert(rule AlertRule, id int, symbol, name string, now time.Time) Alert {
+	return Alert{
+		RuleID:    rule.ID,
+		RuleName:  rule.Name,
+		Metric:    rule.Metric,
+		Condition: rule.Condition,
+		Threshold: rule.Threshold,
+		ID:        id,
+		Symbol:    symbol,
+		Name:      name,
+		FiredAt:   now,
+	}
+}
+
+func (rule AlertRule) matchesSymbol(symbol string) bool {
+	return rule.Symbol == "" || strings.EqualFold(rule.Symbol, symbol)
+}
+
+// Value conditions over every fetched coin. Rank is the coin's place in the
+// metric's stored ranking, or 0 when it didn't make the ranking.
+func evaluateValueRule(rule AlertRule, metricData MetricData, coins []AlertCoin, now time.Time) []Alert {
+	config := sortableMetrics()[rule.Metric]
+	ranks := map[int]int{}
+	if metricData.Success && !metricData.Stale {
+		for i, crypto := range metricData.AllData {
+			ranks[crypto.ID] = rankOf(crypto, i)
+		}
+	}
+
+	var alerts []Alert
+	for _, coin := range coins {
+		value, ok := coin.Values[rule.Metric]
+		if !ok || !rule.matchesSymbol(coin.Symbol) {
+			continue
+		}
+		if (rule.Condition == ConditionValueAbove && value <= rule.Threshold) ||
+			(rule.Condition == ConditionValueBelow && value >= rule.Threshold) {
+			continue
+		}
+
+		alert := newAlert(rule, coin.ID, coin.Symbol, coin.Name, now)
+		alert.Value = formatValue(value, config.Format)
+		alert.RawValue = &value
+		if coin.ID != 0 {
+			alert.Rank = ranks[coin.ID]
+		}
+		direction := "above"
+		if rule.Condition == ConditionValueBelow {
+			direction = "below"
+		}
+		alert.Message = fmt.Sprintf("%s %s is %s (%s %g)", coin.Symbol, config.Name, alert.Value, direction, rule.Threshold)
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+func evaluateRankRule(rule AlertRule, metricData MetricData, now time.Time) []Alert {
+	if metricData.ComparedTo == nil {
+		return nil // Nothing to compare against yet
+	}
+
+	var alerts []Alert
+	top := int(rule.Threshold)
+	for _, change := range metricData.Changes {
+		if !rule.matchesSymbol(change.Symbol) {
+			continue
+		}
+
+		var message string
+		switch rule.Condition {
+		case ConditionEntersTop:
+			if change.Rank > 0 && change.Rank <= top && (change.PreviousRank == 0 || change.PreviousRank > top) {
+				message = fmt.Sprintf("%s entered the top %d in %s (now #%d)", change.Symbol, top, metricData.Name, change.Rank)
+			}
+		case ConditionLeavesTop:
+			if change.PreviousRank > 0 && change.PreviousRank <= top && (change.Rank == 0 || change.Rank > top) {
+				message = fmt.Sprintf("%s left the top %d in %s (was #%d)", change.Symbol, top, metricData.Name, change.PreviousRank)
+			}
+		case ConditionRankUp:
+			if change.PreviousRank > 0 && change.Rank > 0 && change.RankDelta >= top {
+				message = fmt.Sprintf("%s moved up %d places in %s (#%d → #%d)", change.Symbol, change.RankDelta, metricData.Name, change.PreviousRank, change.Rank)
+			}
+		case ConditionRankDown:
+			if change.PreviousRank > 0 && change.Rank > 0 && -change.RankDelta >= top {
+				message = fmt.Sprintf("%s moved down %d places in %s (#%d → #%d)", change.Symbol, -change.RankDelta, metricData.Name, change.PreviousRank, change.Rank)
+			}
+		}
+		if message == "" {
+			continue
+		}
+
+		alert := newAlert(rule, change.ID, change.Symbol, change.Name, now)
+		alert.Rank = change.Rank
+		alert.PreviousRank = change.PreviousRank
+		alert.Message = message
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// Claim the cooldown slot for a rule/coin pair; false means it already fired
+// recently. Coins are keyed by ID, since symbols aren't unique.
+func claimAlertCooldown(ctx context.Context, rule AlertRule, alert Alert) bool {
+	if rule.cooldown == 0 {
+		return true
+	}
+
+	coin := "id:" + strconv.Itoa(alert.ID)
+	if alert.ID == 0 {
+		coin = "symbol:" + alert.Symbol // Data stored before IDs were recorded
+	}
+	key := alertCooldownPrefix + rule.ID + ":" + coin
+	ok, err := store.SetNX(ctx, key, strconv.FormatInt(time.Now().Unix(), 10), rule.cooldown)
+	if err != nil {
+		log.Printf("⚠️  Alert cooldown check failed for %s: %v", key, err)
+		return true
+	}
+	return ok
+}
+
+// Evaluate rules for a run, drop alerts still in cooldown, and record the rest
+func processAlerts(data CryptoDataResponse, coins []AlertCoin) []Alert {
+	if len(alertRules) == 0 {
+		return nil
+	}
+
+	rulesByID := make(map[string]AlertRule, len(alertRules))
+	for _, rule := range alertRules {
+		rulesByID[rule.ID] = rule
+	}
+
+	ctx := context.Background()
+	fired := []Alert{}
+	suppressed := 0
+	for _, alert := range evaluateAlertRules(alertRules, data, coins) {
+		if !claimAlertCooldown(ctx, rulesByID[alert.RuleID], alert) {
+			suppressed++
+			continue
+		}
+		fired = append(fired, alert)
+		log.Printf("🚨 ALERT [%s] %s", alert.RuleID, alert.Message)
+	}
+
+	if len(fired) > 0 {
+		values := make([]string, 0, len(fired))
+		for _, alert := range fired {
+			if raw, err := json.Marshal(alert); err == nil {
+				values = append(values, string(raw))
+			}
+		}
+		if err := store.LPushTrim(ctx, alertRecentKey, alertRecentMax, values...); err != nil {
+			log.Printf("❌ Failed to record alerts: %v", err)
+		}
+	}
+
+	log.Printf("✅ Alerts evaluated: %d fired, %d suppressed by cooldown", len(fired), suppressed)
+	return fired
+}
+
+// Most recent fired alerts, newest first
+func getRecentAlerts(limit int) ([]Alert, error) {
+	ctx := context.Background()
+	values, err := store.LRange(ctx, alertRecentKey, 0, limit-1)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := make([]Alert, 0, len(values))
+	for _, value := range values {
+		var alert Alert
+		if err := json.Unmarshal([]byte(value), &alert); err == nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func alertRule(t *testing.T, rule AlertRule) AlertRule {
+	t.Helper()
+	if err := validateAlertRule(&rule); err != nil {
+		t.Fatalf("rule %s: %v", rule.ID, err)
+	}
+	return rule
+}
+
+func alertSymbols(alerts []Alert) []string {
+	out := make([]string, len(alerts))
+	for i, alert := range alerts {
+		out[i] = alert.Symbol
+	}
+	return out
+}
+
+// Fetched coins priced 100, 99, 98...; IDs start at 1
+func fetchedCoins(symbols ...string) []AlertCoin {
+	coins := make([]AlertCoin, len(symbols))
+	for i, symbol := range symbols {
+		coins[i] = AlertCoin{ID: i + 1, Symbol: symbol, Name: symbol, Values: map[string]float64{"price": float64(100 - i)}}
+	}
+	return coins
+}
+
+func TestEvaluateValueRules(t *testing.T) {
+	coins := fetchedCoins("BTC", "ETH", "SOL")
+	data := CryptoDataResponse{Timestamp: time.Now(), AllMetrics: map[string]MetricData{
+		"price": {Name: "Price", Success: true, AllData: []CryptoData{{ID: 3, Symbol: "SOL", Rank: 1}}},
+	}}
+
+	above := evaluateAlertRules([]AlertRule{alertRule(t, AlertRule{ID: "above", Metric: "price", Condition: ConditionValueAbove, Threshold: 98.5})}, data, coins)
+	if got := alertSymbols(above); len(got) != 2 || got[0] != "BTC" || got[1] != "ETH" {
+		t.Errorf("value_above 98.5: got %v, want [BTC ETH]", got)
+	}
+
+	below := evaluateAlertRules([]AlertRule{alertRule(t, AlertRule{ID: "below", Metric: "price", Symbol: "sol", Condition: ConditionValueBelow, Threshold: 99})}, data, coins)
+	if len(below) != 1 || below[0].ID != 3 || below[0].Rank != 1 || below[0].Value != "$98.00" {
+		t.Errorf("value_below 99 for sol: got %+v, want coin 3 at rank 1 valued $98.00", below)
+	}
+}
+
+func TestValueRulesSeeCoinsOutsideTheRanking(t *testing.T) {
+	// Only BTC made the stored top 1, but every fetched coin is checked once
+	coins := append(fetchedCoins("BTC", "ETH"), fetchedCoins("BTC")...)
+	data := CryptoDataResponse{Timestamp: time.Now(), AllMetrics: map[string]MetricData{
+		"price": {Name: "Price", Success: true, AllData: []CryptoData{{ID: 1, Symbol: "BTC", Rank: 1}}},
+	}}
+	rules := []AlertRule{alertRule(t, AlertRule{ID: "any", Metric: "price", Condition: ConditionValueAbove, Threshold: 0})}
+
+	alerts := evaluateAlertRules(rules, data, coins)
+	if len(alerts) != 2 || alerts[0].Rank != 1 || alerts[1].Symbol != "ETH" || alerts[1].Rank != 0 {
+		t.Errorf("got %+v, want BTC at rank 1 and unranked ETH", alerts)
+	}
+}
+
+func TestAlertCoinsKeepOnlyValueRuleFields(t *testing.T) {
+	defer func(rules []AlertRule) { alertRules = rules }(alertRules)
+	coins := []LunarCrushCoin{{ID: 7, Symbol: "BTC", Fields: map[string]float64{"price": 100, "market_cap": 5}}}
+
+	alertRules = []AlertRule{alertRule(t, AlertRule{ID: "up", Metric: "market_cap", Condition: ConditionRankUp, Threshold: 1})}
+	if got := alertCoins(coins); got != nil {
+		t.Errorf("no value rules: got %+v, want nil", got)
+	}
+
+	alertRules = append(alertRules, alertRule(t, AlertRule{ID: "high", Metric: "price", Condition: ConditionValueAbove, Threshold: 1}))
+	got := alertCoins(coins)
+	if len(got) != 1 || got[0].ID != 7 || len(got[0].Values) != 1 || got[0].Values["price"] != 100 {
+		t.Errorf("got %+v, want coin 7 with only its price", got)
+	}
+}
+
+func TestEvaluateRankRules(t *testing.T) {
+	previous := ranked("BTC", "ETH", "SOL", "XRP", "DOGE")
+	current := ranked("SOL", "BTC", "ETH", "DOGE", "XRP")
+	comparedTo := time.Now().Add(-5 * time.Minute)
+	metricData := MetricData{Name: "Market Cap", Success: true, AllData: current, Changes: computeRankChanges(current, previous), ComparedTo: &comparedTo}
+	now := time.Now()
+
+	tests := []struct {
+		condition string
+		threshold float64
+		want      []string
+	}{
+		{ConditionEntersTop, 1, []string{"SOL"}},
+		{ConditionLeavesTop, 2, []string{"ETH"}},
+		{ConditionRankUp, 2, []string{"SOL"}},
+		{ConditionRankDown, 1, []string{"BTC", "ETH", "XRP"}},
+	}
+	for _, tt := range tests {
+		rule := alertRule(t, AlertRule{ID: tt.condition, Metric: "market_cap", Condition: tt.condition, Threshold: tt.threshold})
+		got := alertSymbols(evaluateRankRule(rule, metricData, now))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s %g: got %v, want %v", tt.condition, tt.threshold, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s %g: got %v, want %v", tt.condition, tt.threshold, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// Without a previous run there is nothing to compare against
+	metricData.ComparedTo = nil
+	if alerts := evaluateRankRule(alertRule(t, AlertRule{ID: "up", Metric: "market_cap", Condition: ConditionRankUp, Threshold: 1}), metricData, now); len(alerts) != 0 {
+		t.Errorf("first run fired %v", alertSymbols(alerts))
+	}
+}
+
+func TestRankRulesSkipStaleAndFailed(t *testing.T) {
+	current := ranked("ETH", "BTC")
+	comparedTo := time.Now().Add(-5 * time.Minute)
+	rules := []AlertRule{alertRule(t, AlertRule{ID: "top", Metric: "market_cap", Condition: ConditionEntersTop, Threshold: 1})}
+	data := CryptoDataResponse{Timestamp: time.Now(), AllMetrics: map[string]MetricData{
+		"market_cap": {Success: true, Stale: true, AllData: current, Changes: computeRankChanges(current, ranked("BTC", "ETH")), ComparedTo: &comparedTo},
+	}}
+	if alerts := evaluateAlertRules(rules, data, nil); len(alerts) != 0 {
+		t.Errorf("stale metric fired %v", alertSymbols(alerts))
+	}
+
+	metricData := data.AllMetrics["market_cap"]
+	metricData.Stale, metricData.Success = false, false
+	data.AllMetrics["market_cap"] = metricData
+	if alerts := evaluateAlertRules(rules, data, nil); len(alerts) != 0 {
+		t.Errorf("failed metric fired %v", alertSymbols(alerts))
+	}
+}
+
+func TestProcessAlertsCooldown(t *testing.T) {
+	store = newFailoverStore(nil)
+	defer func(rules []AlertRule) { alertRules = rules }(alertRules)
+	alertRules = []AlertRule{alertRule(t, AlertRule{ID: "btc-high", Metric: "price", Symbol: "BTC", Condition: ConditionValueAbove, Threshold: 1})}
+
+	data := CryptoDataResponse{Timestamp: time.Now(), AllMetrics: map[string]MetricData{"price": {Name: "Price", Success: true}}}
+	if fired := processAlerts(data, fetchedCoins("BTC", "ETH")); len(fired) != 1 {
+		t.Fatalf("first run fired %d alerts, want 1", len(fired))
+	}
+	if fired := processAlerts(data, fetchedCoins("BTC", "ETH")); len(fired) != 0 {
+		t.Errorf("second run fired %d alerts inside the cooldown, want 0", len(fired))
+	}
+
+	// Another coin with the same symbol has its own cooldown
+	otherBTC := []AlertCoin{{ID: 99, Symbol: "BTC", Values: map[string]float64{"price": 5}}}
+	if fired := processAlerts(data, otherBTC); len(fired) != 1 || fired[0].ID != 99 {
+		t.Errorf("other BTC coin: got %+v, want one alert for coin 99", fired)
+	}
+
+	recent, err := getRecentAlerts(10)
+	if err != nil || len(recent) != 2 || recent[0].RuleID != "btc-high" {
+		t.Errorf("recent alerts: got %+v (%v), want two btc-high alerts", recent, err)
+	}
+}
+
+func TestReadAlertRulesRejectsInvalidRules(t *testing.T) {
+	tests := map[string]string{
+		"unknown metric":    `{"rules":[{"id":"a","metric":"nope","condition":"value_above"}]}`,
+		"unknown condition": `{"rules":[{"id":"a","metric":"price","condition":"sideways"}]}`,
+		"rank threshold":    `{"rules":[{"id":"a","metric":"price","condition":"enters_top","threshold":0}]}`,
+		"duplicate id":      `{"rules":[{"id":"a","metric":"price","condition":"value_above"},{"id":"a","metric":"price","condition":"value_below"}]}`,
+		"bad cooldown":      `{"rules":[{"id":"a","metric":"price","condition":"value_above","cooldown":"soon"}]}`,
+	}
+	for name, body := range tests {
+		path := filepath.Join(t.TempDir(), "alerts.json")
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readAlertRules(path); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
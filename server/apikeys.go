@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Partner API keys for the public data routes. Only the SHA-256 of a key is
+// stored; the key itself is shown once, when it is issued. Each key has its
+// own sliding-window rate limit and usage counters.
+//
+// Requests without a key follow ANONYMOUS_ACCESS:
+//
+//	allow   (default) no limit, as before API keys existed
+//	limited           rate-limited per client IP (ANONYMOUS_RATE_LIMIT)
+//	deny              401 unless a key is sent
+const (
+	AnonymousAllow   = "allow"
+	AnonymousLimited = "limited"
+	AnonymousDeny    = "deny"
+
+	apiKeysKey        = "crypto:apikeys"       // Hash: key hash -> APIKey JSON
+	apiKeyIndexKey    = "crypto:apikeys:index" // Hash: key ID -> key hash
+	apiKeyUsagePrefix = "crypto:apikeys:usage:"
+	apiKeyRatePrefix  = "crypto:ratelimit:key:"
+	anonRatePrefix    = "crypto:ratelimit:anon:"
+
+	apiKeyPrefix    = "ck_"
+	apiKeyIDContext = "api_key_id"
+)
+
+var (
+	anonymousAccess    = AnonymousAllow
+	apiKeyRateLimit    = 600         // API_KEY_RATE_LIMIT, requests per window unless the key sets its own
+	anonymousRateLimit = 60          // ANONYMOUS_RATE_LIMIT
+	rateLimitWindow    = time.Minute // RATE_LIMIT_WINDOW
+	trustedProxies     []string      // TRUSTED_PROXIES, IPs or CIDRs allowed to set X-Forwarded-For
+	apiKeyUsageDays    = 90          // API_KEY_USAGE_DAYS, daily counters kept per key
+)
+
+var (
+	errAPIKeyNotFound    = errors.New("API key not found")
+	errAPIKeyUnavailable = errors.New("API key can't be checked while storage is degraded")
+)
+
+// Key records last read from Redis, by key hash. While Redis is down the
+// memory fallback holds no keys, so partners are checked against these.
+var apiKeyCache sync.Map
+
+// Day each key's old daily counters were last trimmed, by key ID
+var apiKeyUsageTrimmed sync.Map
+
+// APIKey is the stored record for an issued key
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`               // Start of the key, to tell keys apart
+	RateLimit int        `json:"rate_limit,omitempty"` // Requests per window; 0 uses API_KEY_RATE_LIMIT
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy string     `json:"revoked_by,omitempty"`
+}
+
+// APIKeyUsage counts requests made with a key. Daily maps YYYY-MM-DD (UTC) to requests.
+type APIKeyUsage struct {
+	Total       int64            `json:"total"`
+	RateLimited int64            `json:"rate_limited"`
+	LastUsed    *time.Time       `json:"last_used,omitempty"`
+	Daily       map[string]int64 `json:"daily"`
+}
+
+// APIKeyRequest is the body of POST /dev/apikeys
+type APIKeyRequest struct {
+	Name      string `json:"name" binding:"required"`
+	RateLimit int    `json:"rate_limit,omitempty"`
+}
+
+func (r APIKeyRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.RateLimit < 0 {
+		return fmt.Errorf("rate_limit must be positive")
+	}
+	return nil
+}
+
+// APIKeyWithUsage is one entry in GET /dev/apikeys
+type APIKeyWithUsage struct {
+	APIKey
+	Usage APIKeyUsage `json:"usage"`
+}
+
+func initAPIKeyConfig() {
+	if access := os.Getenv("ANONYMOUS_ACCESS"); access != "" {
+		if access != AnonymousAllow && access != AnonymousLimited && access != AnonymousDeny {
+			log.Fatalf("Unknown ANONYMOUS_ACCESS %q (use %s, %s or %s)", access, AnonymousAllow, AnonymousLimited, AnonymousDeny)
+		}
+		anonymousAccess = access
+	}
+	apiKeyRateLimit = intFromEnv("API_KEY_RATE_LIMIT", apiKeyRateLimit)
+	anonymousRateLimit = intFromEnv("ANONYMOUS_RATE_LIMIT", anonymousRateLimit)
+	rateLimitWindow = durationFromEnv("RATE_LIMIT_WINDOW", rateLimitWindow)
+	apiKeyUsageDays = intFromEnv("API_KEY_USAGE_DAYS", apiKeyUsageDays)
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	log.Printf("✅ API keys: %d requests per %s, anonymous access: %s", apiKeyRateLimit, rateLimitWindow, anonymousAccess)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (k APIKey) limit() int {
+	if k.RateLimit > 0 {
+		return k.RateLimit
+	}
+	return apiKeyRateLimit
+}
+
+// Create a key and return it together with its record. The key is not stored.
+func issueAPIKey(req APIKeyRequest, createdBy string) (string, APIKey, error) {
+	key := apiKeyPrefix + randomHex(24)
+	record := APIKey{
+		ID:        "key_" + randomHex(8),
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		RateLimit: req.RateLimit,
+		CreatedAt: time.Now().UTC(),
+		CreatedBy: createdBy,
+	}
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+
+	ctx := context.Background()
+	hash := hashAPIKey(key)
+	if err := store.HSet(ctx, apiKeysKey, hash, string(raw)); err != nil {
+		return "", APIKey{}, err
+	}
+	if err := store.HSet(ctx, apiKeyIndexKey, record.ID, hash); err != nil {
+		return "", APIKey{}, err
+	}
+	log.Printf("🔑 Issued API key %s (%s) by %s", record.ID, record.Name, createdBy)
+	return key, record, nil
+}
+
+// Record for a presented key; errAPIKeyNotFound when it was never issued.
+// While Redis is down, keys it has served before are taken from apiKeyCache
+// and any other key gets errAPIKeyUnavailable rather than a false 401.
+func lookupAPIKey(ctx context.Context, key string) (APIKey, error) {
+	hash := hashAPIKey(key)
+	raw, err := store.HGet(ctx, apiKeysKey, hash)
+	if errors.Is(err, ErrNotFound) {
+		if !store.degraded() {
+			apiKeyCache.Delete(hash)
+			return APIKey{}, errAPIKeyNotFound
+		}
+		if cached, ok := apiKeyCache.Load(hash); ok {
+			return cached.(APIKey), nil
+		}
+		return APIKey{}, errAPIKeyUnavailable
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	var record APIKey
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return APIKey{}, err
+	}
+	if store.redisAvailable() {
+		apiKeyCache.Store(hash, record)
+	}
+	return record, nil
+}
+
+// Revoked keys stay listed so their usage remains visible
+func revokeAPIKey(id, revokedBy string) (APIKey, error) {
+	ctx := context.Background()
+	hash, err := store.HGet(ctx, apiKeyIndexKey, id)
+	if errors.Is(err, ErrNotFound) {
+		return APIKey{}, errAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	raw, err := store.HGet(ctx, apiKeysKey, hash)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	var record APIKey
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return APIKey{}, err
+	}
+	if record.RevokedAt != nil {
+		return record, nil
+	}
+	now := time.Now().UTC()
+	record.RevokedAt = &now
+	record.RevokedBy = revokedBy
+
+	updated, err := json.Marshal(record)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if err := store.HSet(ctx, apiKeysKey, hash, string(updated)); err != nil {
+		return APIKey{}, err
+	}
+	apiKeyCache.Store(hash, record)
+	log.Printf("🔑 Revoked API key %s (%s) by %s", record.ID, record.Name, revokedBy)
+	return record, nil
+}
+
+// All issued keys with their usage, oldest first
+func listAPIKeys() ([]APIKeyWithUsage, error) {
+	fields, err := store.HGetAll(context.Background(), apiKeysKey)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]APIKeyWithUsage, 0, len(fields))
+	for _, raw := range fields {
+		var record APIKey
+		if err := json.Unmarshal([]byte(raw), &record); err != nil {
+			continue
+		}
+		usage, err := getAPIKeyUsage(record.ID)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, APIKeyWithUsage{APIKey: record, Usage: usage})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func recordAPIKeyUsage(ctx context.Context, id string, rateLimited bool) {
+	key := apiKeyUsagePrefix + id
+	now := time.Now().UTC()
+	today := now.Format("2006-01-02")
+
+	fields := []string{"total", today}
+	if rateLimited {
+		fields = []string{"rate_limited"}
+	}
+	for _, field := range fields {
+		if _, err := store.HIncrBy(ctx, key, field, 1); err != nil {
+			log.Printf("⚠️  Failed to count API key usage for %s: %v", id, err)
+			return
+		}
+	}
+	if !rateLimited {
+		if err := store.HSet(ctx, key, "last_used", now.Format(time.RFC3339)); err != nil {
+			log.Printf("⚠️  Failed to record API key use for %s: %v", id, err)
+		}
+	}
+	if last, _ := apiKeyUsageTrimmed.Swap(id, today); last != today {
+		trimAPIKeyUsage(ctx, id, now)
+	}
+}
+
+// Drop daily counters older than API_KEY_USAGE_DAYS. Runs once a day per key;
+// total keeps counting every request.
+func trimAPIKeyUsage(ctx context.Context, id string, now time.Time) {
+	key := apiKeyUsagePrefix + id
+	fields, err := store.HGetAll(ctx, key)
+	if err != nil {
+		log.Printf("⚠️  Failed to trim API key usage for %s: %v", id, err)
+		return
+	}
+	cutoff := now.AddDate(0, 0, -apiKeyUsageDays).Format("2006-01-02")
+	for field := range fields {
+		if _, err := time.Parse("2006-01-02", field); err != nil || field >= cutoff {
+			continue
+		}
+		if _, err := store.HDel(ctx, key, field); err != nil {
+			log.Printf("⚠️  Failed to trim API key usage for %s: %v", id, err)
+			return
+		}
+	}
+}
+
+func getAPIKeyUsage(id string) (APIKeyUsage, error) {
+	fields, err := store.HGetAll(context.Background(), apiKeyUsagePrefix+id)
+	if err != nil {
+		return APIKeyUsage{}, err
+	}
+
+	usage := APIKeyUsage{Daily: map[string]int64{}}
+	for field, value := range fields {
+		switch field {
+		case "last_used":
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				usage.LastUsed = &t
+			}
+		case "total":
+			usage.Total, _ = strconv.ParseInt(value, 10, 64)
+		case "rate_limited":
+			usage.RateLimited, _ = strconv.ParseInt(value, 10, 64)
+		default:
+			usage.Daily[field], _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return usage, nil
+}
+
+// Apply a sliding-window limit and set the X-RateLimit headers. False means
+// the request was answered with 429. Storage errors let the request through.
+func allowRequest(c *gin.Context, key string, limit int) bool {
+	result, err := store.SlidingWindowAllow(c.Request.Context(), key, limit, rateLimitWindow)
+	if err != nil {
+		log.Printf("⚠️  Rate limit check failed for %s: %v", key, err)
+		return true
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(max(limit-result.Count, 0)))
+	if result.Allowed {
+		return true
+	}
+
+	retryAfter := int64(math.Ceil(result.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.FormatInt(max(retryAfter, 1), 10))
+	c.AbortWithStatusJSON(429, gin.H{
+		"error":       "Rate limit exceeded",
+		"limit":       limit,
+		"window":      rateLimitWindow.String(),
+		"retry_after": max(retryAfter, 1),
+	})
+	return false
+}
+
+// requireAPIKey authenticates and rate-limits the public data routes. A key,
+// when sent, must be valid even if anonymous access is allowed.
+func requireAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		key := requestAPIKey(c)
+		if key == "" {
+			switch anonymousAccess {
+			case AnonymousDeny:
+				c.AbortWithStatusJSON(401, gin.H{"error": "API key required"})
+				return
+			case AnonymousLimited:
+				if !allowRequest(c, anonRatePrefix+c.ClientIP(), anonymousRateLimit) {
+					return
+				}
+			}
+			c.Next()
+			return
+		}
+
+		record, err := lookupAPIKey(ctx, key)
+		if errors.Is(err, errAPIKeyNotFound) || (err == nil && record.RevokedAt != nil) {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Invalid or revoked API key"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(503, gin.H{"error": "API key storage unavailable", "message": err.Error()})
+			return
+		}
+
+		c.Set(apiKeyIDContext, record.ID)
+		if !allowRequest(c, apiKeyRatePrefix+record.ID, record.limit()) {
+			recordAPIKeyUsage(ctx, record.ID, true)
+			return
+		}
+		recordAPIKeyUsage(ctx, record.ID, false)
+		c.Next()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLookupAPIKeyWhileDegraded(t *testing.T) {
+	s, server := newTestFailoverStore(t)
+	store = s
+	ctx := context.Background()
+
+	key, record, err := issueAPIKey(APIKeyRequest{Name: "partner"}, "ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lookupAPIKey(ctx, key); err != nil {
+		t.Fatalf("lookup while Redis is up: %v", err)
+	}
+	unseen, _, err := issueAPIKey(APIKeyRequest{Name: "unseen"}, "ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	s.markDown(errors.New("test outage"))
+
+	if got, err := lookupAPIKey(ctx, key); err != nil || got.ID != record.ID {
+		t.Errorf("known key during the outage: %+v, %v, want it served from the cache", got, err)
+	}
+	if _, err := lookupAPIKey(ctx, unseen); !errors.Is(err, errAPIKeyUnavailable) {
+		t.Errorf("unseen key during the outage: %v, want errAPIKeyUnavailable (503), not a 401", err)
+	}
+}
+
+func TestTrimAPIKeyUsage(t *testing.T) {
+	store = newFailoverStore(nil)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	key := apiKeyUsagePrefix + "key_test"
+	for field, value := range map[string]string{
+		"total":      "30",
+		"last_used":  now.Format(time.RFC3339),
+		"2026-10-16": "10",
+		"2026-07-18": "10", // 90 days back, still kept
+		"2026-07-17": "10",
+	} {
+		if err := store.HSet(ctx, key, field, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trimAPIKeyUsage(ctx, "key_test", now)
+
+	usage, err := getAPIKeyUsage("key_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, kept := usage.Daily["2026-07-17"]; kept || len(usage.Daily) != 2 {
+		t.Errorf("daily counters %v, want only the last 90 days", usage.Daily)
+	}
+	if usage.Total != 30 || usage.LastUsed == nil {
+		t.Errorf("trim touched total (%d) or last_used (%v)", usage.Total, usage.LastUsed)
+	}
+}
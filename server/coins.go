@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errCoinNotFound = errors.New("coin not found")
+
+// errAmbiguousSymbol means several coins share the symbol; callers have to
+// pass one of the IDs instead
+type errAmbiguousSymbol struct {
+	symbol string
+	ids    []int
+}
+
+func (e errAmbiguousSymbol) Error() string {
+	return fmt.Sprintf("symbol %s is shared by coins %v; use the coin ID", e.symbol, e.ids)
+}
+
+// Coins are identified by their LunarCrush ID. A reference is either the ID
+// or a symbol, which has to resolve to exactly one coin in the latest run.
+func resolveCoin(ref string) (int, string, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := strconv.Atoi(ref); err == nil && id > 0 {
+		return id, coinSymbol(id), nil
+	}
+
+	latest, exists := getLatestDataFromRedis()
+	if !exists {
+		return 0, "", errCoinNotFound
+	}
+	symbol := strings.ToUpper(ref)
+	seen := map[int]bool{}
+	for _, metricData := range latest.AllMetrics {
+		for _, crypto := range metricData.AllData {
+			if crypto.ID != 0 && strings.EqualFold(crypto.Symbol, symbol) {
+				seen[crypto.ID] = true
+			}
+		}
+	}
+
+	switch len(seen) {
+	case 0:
+		return 0, "", errCoinNotFound
+	case 1:
+		for id := range seen {
+			return id, symbol, nil
+		}
+	}
+	ids := make([]int, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return 0, "", errAmbiguousSymbol{symbol: symbol, ids: ids}
+}
+
+// Symbol of a coin in the latest run; empty when it isn't ranked there
+func coinSymbol(id int) string {
+	latest, _ := getLatestDataFromRedis()
+	for _, metricData := range latest.AllMetrics {
+		for _, crypto := range metricData.AllData {
+			if crypto.ID == id {
+				return crypto.Symbol
+			}
+		}
+	}
+	return ""
+}
+
+// Whether an entry is the given coin. Entries stored before IDs were
+// recorded fall back to the symbol.
+func isCoin(crypto CryptoData, id int, symbol string) bool {
+	if crypto.ID != 0 {
+		return crypto.ID == id
+	}
+	return symbol != "" && strings.EqualFold(crypto.Symbol, symbol)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Browser origins allowed to call the API come from a profile (CORS_PROFILE),
+// or from CORS_ORIGINS, which replaces the profile's list. Entries are:
+//
+//	https://example.com            exact origin
+//	https://crypto-rankings-*.vercel.app
+//	                               glob; * matches within one host label
+//	re:^https://[a-z]+\.example\.com$
+//	                               anchored regular expression
+//	*                              any origin (not allowed in production)
+//
+// Origins are lowercased before matching. Credentials (CORS_ALLOW_CREDENTIALS)
+// are only allowed when every entry is an exact origin. Unset, they stay on for
+// production when its origins are all exact, as they were before profiles.
+const (
+	CORSProfileDevelopment = "development"
+	CORSProfilePreview     = "preview"
+	CORSProfileProduction  = "production"
+)
+
+var corsProfiles = map[string][]string{
+	CORSProfileProduction: {
+		"https://crypto-rankings.vercel.app",
+		"https://crypto-rankings-2vobnla22-danilobatsons-projects.vercel.app", // Current Vercel deployment
+	},
+	CORSProfilePreview: {
+		"https://crypto-rankings.vercel.app",
+		"https://crypto-rankings-*.vercel.app", // Vercel preview deployments
+	},
+	CORSProfileDevelopment: {
+		"http://localhost:3000",
+		"http://localhost:3001",
+		"https://crypto-rankings.vercel.app",
+		"https://crypto-rankings-*.vercel.app",
+	},
+}
+
+// corsPolicy decides which origins may call the API, for CORS and WebSocket upgrades
+type corsPolicy struct {
+	profile     string
+	origins     []string // As configured, for logging
+	exact       map[string]bool
+	patterns    []*regexp.Regexp
+	allowAll    bool
+	credentials bool
+}
+
+func (p *corsPolicy) allows(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Any entry other than an exact origin
+func (p *corsPolicy) broad() bool {
+	return p.allowAll || len(p.patterns) > 0
+}
+
+// Load and validate the origin policy; any invalid entry is fatal
+func loadCORSPolicy() *corsPolicy {
+	// Unset means production, so a deploy that forgets it gets the strict list
+	profile := os.Getenv("CORS_PROFILE")
+	if profile == "" {
+		profile = CORSProfileProduction
+	}
+	origins, known := corsProfiles[profile]
+	if !known {
+		log.Fatalf("Unknown CORS_PROFILE %q (use %s, %s or %s)", profile, CORSProfileDevelopment, CORSProfilePreview, CORSProfileProduction)
+	}
+	if raw := os.Getenv("CORS_ORIGINS"); raw != "" {
+		origins = nil
+		for _, origin := range strings.Split(raw, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+	}
+
+	credentials := os.Getenv("CORS_ALLOW_CREDENTIALS")
+	policy, err := newCORSPolicy(profile, origins, credentials == "true")
+	if err != nil {
+		log.Fatal("Invalid CORS policy: ", err)
+	}
+	if credentials == "" && profile == CORSProfileProduction && !policy.broad() {
+		policy.credentials = true
+	}
+	log.Printf("✅ CORS profile %s: %s (credentials: %v)", profile, strings.Join(policy.origins, ", "), policy.credentials)
+	return policy
+}
+
+func newCORSPolicy(profile string, origins []string, credentials bool) (*corsPolicy, error) {
+	if len(origins) == 0 {
+		return nil, fmt.Errorf("no origins configured")
+	}
+
+	policy := &corsPolicy{profile: profile, origins: origins, exact: map[string]bool{}, credentials: credentials}
+	for _, origin := range origins {
+		if err := policy.add(origin); err != nil {
+			return nil, fmt.Errorf("origin %q: %w", origin, err)
+		}
+	}
+	if credentials && policy.broad() {
+		return nil, fmt.Errorf("CORS_ALLOW_CREDENTIALS needs exact origins, not wildcards or patterns")
+	}
+	return policy, nil
+}
+
+func (p *corsPolicy) add(origin string) error {
+	production := p.profile == CORSProfileProduction
+
+	if origin == "*" {
+		if production {
+			return fmt.Errorf("any-origin is not allowed in production")
+		}
+		p.allowAll = true
+		return nil
+	}
+
+	if expr, ok := strings.CutPrefix(origin, "re:"); ok {
+		if !strings.HasPrefix(expr, "^") || !strings.HasSuffix(expr, "$") {
+			return fmt.Errorf("regular expression must be anchored with ^ and $")
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		p.patterns = append(p.patterns, pattern)
+		return nil
+	}
+
+	// Validate everything but the wildcards, which url.Parse would accept anyway
+	u, err := url.Parse(strings.ReplaceAll(origin, "*", "x"))
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("scheme must be http or https")
+	case u.Host == "":
+		return fmt.Errorf("missing host")
+	case u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "":
+		return fmt.Errorf("an origin is only scheme://host[:port]")
+	}
+	if production {
+		if u.Scheme != "https" {
+			return fmt.Errorf("production origins must use https")
+		}
+		if host := u.Hostname(); host == "localhost" || host == "127.0.0.1" {
+			return fmt.Errorf("localhost is not allowed in production")
+		}
+	}
+
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	if !strings.Contains(origin, "*") {
+		p.exact[origin] = true
+		return nil
+	}
+
+	// A wildcard in the last two labels would match unrelated domains
+	host, _, _ := strings.Cut(strings.TrimPrefix(origin, u.Scheme+"://"), ":")
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 || strings.Contains(labels[len(labels)-1]+labels[len(labels)-2], "*") {
+		return fmt.Errorf("wildcard must leave the last two host labels literal (e.g. https://app-*.example.com)")
+	}
+
+	// Escape everything, then let * match within a single host label
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(origin), `\*`, `[a-z0-9-]+`) + "$"
+	p.patterns = append(p.patterns, regexp.MustCompile(expr))
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import "testing"
+
+func TestCORSPolicyAllows(t *testing.T) {
+	policy, err := newCORSPolicy(CORSProfilePreview, []string{
+		"https://crypto-rankings.vercel.app",
+		"https://crypto-rankings-*.vercel.app",
+		"https://*.staging.example.com:8443",
+		`re:^https://(alpha|beta)\.example\.org$`,
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		// Exact, case-insensitive, scheme and port must match
+		{"https://crypto-rankings.vercel.app", true},
+		{"HTTPS://Crypto-Rankings.Vercel.App", true},
+		{"http://crypto-rankings.vercel.app", false},
+		{"https://crypto-rankings.vercel.app:8443", false},
+		// Glob: * matches within one label only
+		{"https://crypto-rankings-git-main-team.vercel.app", true},
+		{"https://crypto-rankings-.vercel.app", false},
+		{"https://crypto-rankings-a.b.vercel.app", false},
+		{"https://evil.crypto-rankings-x.vercel.app", false},
+		{"https://crypto-rankings-x.vercel.app.evil.com", false},
+		{"https://crypto-rankings-x_y.vercel.app", false},
+		{"https://pr-12.staging.example.com:8443", true},
+		{"https://pr-12.staging.example.com", false},
+		// Dots in the configured origin are literal
+		{"https://crypto-rankings-xvercelxapp", false},
+		// Regular expressions are matched as written
+		{"https://alpha.example.org", true},
+		{"https://gamma.example.org", false},
+		{"https://alpha.example.org.evil.com", false},
+		{"", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		if got := policy.allows(tt.origin); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPolicyAllowAll(t *testing.T) {
+	policy, err := newCORSPolicy(CORSProfileDevelopment, []string{"*"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.allows("https://anything.example") || !policy.broad() {
+		t.Error("* should allow any origin and count as broad")
+	}
+}
+
+func TestCORSPolicyRejectsInvalidEntries(t *testing.T) {
+	tests := []struct {
+		profile string
+		origin  string
+	}{
+		{CORSProfileProduction, "*"},
+		{CORSProfileProduction, "http://crypto-rankings.vercel.app"},
+		{CORSProfileProduction, "https://localhost:3000"},
+		{CORSProfileProduction, "https://127.0.0.1"},
+		{CORSProfileDevelopment, "ftp://example.com"},
+		{CORSProfileDevelopment, "example.com"},
+		{CORSProfileDevelopment, "https://"},
+		{CORSProfileDevelopment, "https://example.com/path"},
+		{CORSProfileDevelopment, "https://example.com?x=1"},
+		{CORSProfileDevelopment, "https://user@example.com"},
+		{CORSProfileDevelopment, "https://*.com"},
+		{CORSProfileDevelopment, "https://app.*.com"},
+		{CORSProfileDevelopment, "https://app.example.*"},
+		{CORSProfileDevelopment, "re:https://example\\.com"},
+		{CORSProfileDevelopment, "re:^https://example\\.com"},
+		{CORSProfileDevelopment, "re:^https://(example\\.com$"},
+	}
+	for _, tt := range tests {
+		if _, err := newCORSPolicy(tt.profile, []string{tt.origin}, false); err == nil {
+			t.Errorf("%s: %q accepted, want an error", tt.profile, tt.origin)
+		}
+	}
+
+	if _, err := newCORSPolicy(CORSProfileDevelopment, nil, false); err == nil {
+		t.Error("empty origin list accepted, want an error")
+	}
+}
+
+func TestCORSPolicyCredentialsNeedExactOrigins(t *testing.T) {
+	if _, err := newCORSPolicy(CORSProfilePreview, []string{"https://app.example.com"}, true); err != nil {
+		t.Errorf("exact origin with credentials: %v", err)
+	}
+	for _, origin := range []string{"*", "https://app-*.example.com", `re:^https://app\.example\.com$`} {
+		if _, err := newCORSPolicy(CORSProfileDevelopment, []string{origin}, true); err == nil {
+			t.Errorf("%q with credentials accepted, want an error", origin)
+		}
+	}
+}
+
+func TestCORSProfilesAreValid(t *testing.T) {
+	for profile, origins := range corsProfiles {
+		if _, err := newCORSPolicy(profile, origins, false); err != nil {
+			t.Errorf("profile %s: %v", profile, err)
+		}
+	}
+}
+
+func TestLoadCORSPolicyDefaultsToProduction(t *testing.T) {
+	t.Setenv("CORS_PROFILE", "")
+	t.Setenv("CORS_ORIGINS", "")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "")
+
+	policy := loadCORSPolicy()
+	if policy.profile != CORSProfileProduction {
+		t.Errorf("profile %s, want %s", policy.profile, CORSProfileProduction)
+	}
+	if policy.allows("http://localhost:3000") {
+		t.Error("default policy allows localhost")
+	}
+	// Same origins and credentials as before profiles existed
+	for _, origin := range []string{"https://crypto-rankings.vercel.app", "https://crypto-rankings-2vobnla22-danilobatsons-projects.vercel.app"} {
+		if !policy.allows(origin) {
+			t.Errorf("default policy refuses %s", origin)
+		}
+	}
+	if !policy.credentials {
+		t.Error("default policy turned credentials off")
+	}
+}
+
+func TestLoadCORSPolicyCredentialsDefault(t *testing.T) {
+	tests := []struct {
+		profile, origins, credentials string
+		want                          bool
+	}{
+		{CORSProfileProduction, "", "false", false},
+		{CORSProfileProduction, "https://app-*.example.com", "", false}, // Patterns can't carry credentials
+		{CORSProfilePreview, "", "", false},
+		{CORSProfilePreview, "https://app.example.com", "true", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("CORS_PROFILE", tt.profile)
+		t.Setenv("CORS_ORIGINS", tt.origins)
+		t.Setenv("CORS_ALLOW_CREDENTIALS", tt.credentials)
+		if got := loadCORSPolicy().credentials; got != tt.want {
+			t.Errorf("%s %q credentials %q: got %v, want %v", tt.profile, tt.origins, tt.credentials, got, tt.want)
+		}
+	}
+}
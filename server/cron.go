@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard 5-field cron expression (minute hour
+// day-of-month month day-of-week), evaluated in UTC like Inngest's CronTrigger.
+// Fields accept *, numbers, ranges (1-5), steps (*/5, 0-30/10) and lists.
+type cronSchedule struct {
+	expr                   string
+	minute, hour, dom, dow uint64 // Bit n set when value n matches
+	month                  uint64
+	domAny, dowAny         bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &cronSchedule{expr: expr}
+	specs := []struct {
+		name     string
+		field    string
+		min, max int
+		bits     *uint64
+	}{
+		{"minute", fields[0], 0, 59, &s.minute},
+		{"hour", fields[1], 0, 23, &s.hour},
+		{"day of month", fields[2], 1, 31, &s.dom},
+		{"month", fields[3], 1, 12, &s.month},
+		{"day of week", fields[4], 0, 7, &s.dow},
+	}
+	for _, spec := range specs {
+		bits, err := parseCronField(spec.field, spec.min, spec.max)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %s: %w", expr, spec.name, err)
+		}
+		*spec.bits = bits
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	// Any spelling of every day (*, */1, 1-31, 0-6) is unrestricted
+	s.domAny = coversRange(s.dom, 1, 31)
+	s.dowAny = coversRange(s.dow, 0, 6)
+	return s, nil
+}
+
+func coversRange(bits uint64, min, max int) bool {
+	want := uint64(1)<<(max+1) - uint64(1)<<min
+	return bits&want == want
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if base, stepText, found := strings.Cut(part, "/"); found {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+			part, step = base, n
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			loText, hiText, isRange := strings.Cut(part, "-")
+			var err error
+			if lo, err = strconv.Atoi(loText); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiText); err != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+			} else if step > 1 {
+				hi = max // 5/15 means from 5 every 15
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Days match on day-of-month or day-of-week; when one of them allows every day only the other counts
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dowMatch
+	case s.dowAny:
+		return domMatch
+	}
+	return domMatch || dowMatch
+}
+
+// First matching minute strictly after t; zero if none within five years
+func (s *cronSchedule) next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Human-readable schedule for API responses, e.g. "Every 5 minutes" or "Cron 0 * * * * (UTC)"
+func (s *cronSchedule) describe() string {
+	fields := strings.Fields(s.expr)
+	if len(fields) == 5 && strings.Join(fields[1:], " ") == "* * * *" {
+		switch {
+		case fields[0] == "*":
+			return "Every minute"
+		case strings.HasPrefix(fields[0], "*/"):
+			if n, err := strconv.Atoi(fields[0][2:]); err == nil && n > 0 && 60%n == 0 {
+				return fmt.Sprintf("Every %d minutes", n)
+			}
+		}
+	}
+	return fmt.Sprintf("Cron %s (UTC)", s.expr)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func utc(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr  string
+		after string
+		want  string
+	}{
+		// Strictly after, to the minute
+		{"*/5 * * * *", "2026-10-16T12:03:30Z", "2026-10-16T12:05:00Z"},
+		{"*/5 * * * *", "2026-10-16T12:05:00Z", "2026-10-16T12:10:00Z"},
+		{"*/5 * * * *", "2026-10-16T23:59:00Z", "2026-10-17T00:00:00Z"},
+		// Start/step without a range runs to the end of the field
+		{"5/15 * * * *", "2026-10-16T10:00:00Z", "2026-10-16T10:05:00Z"},
+		{"5/15 * * * *", "2026-10-16T10:50:00Z", "2026-10-16T11:05:00Z"},
+		{"0-30/10 * * * *", "2026-10-16T10:31:00Z", "2026-10-16T11:00:00Z"},
+		// Lists and ranges
+		{"0 9,17 * * *", "2026-10-16T09:00:00Z", "2026-10-16T17:00:00Z"},
+		{"0 9 * * 1-5", "2026-10-16T10:00:00Z", "2026-10-19T09:00:00Z"},
+		// Day of week 7 is Sunday
+		{"0 0 * * 7", "2026-10-16T10:00:00Z", "2026-10-18T00:00:00Z"},
+		// Month and year rollover
+		{"30 2 1 * *", "2026-10-16T10:00:00Z", "2026-11-01T02:30:00Z"},
+		{"0 0 1 1 *", "2026-10-16T10:00:00Z", "2027-01-01T00:00:00Z"},
+		{"0 0 29 2 *", "2026-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		// Day of month and day of week both set: either one matches
+		{"0 0 13 * 5", "2026-10-10T00:00:00Z", "2026-10-13T00:00:00Z"},
+		{"0 0 13 * 5", "2026-10-13T00:00:00Z", "2026-10-16T00:00:00Z"},
+		// A field that spells out every day is unrestricted, like "*"
+		{"0 0 */1 * 5", "2026-10-13T00:00:00Z", "2026-10-16T00:00:00Z"},
+		{"0 0 13 * 0-6", "2026-10-10T00:00:00Z", "2026-10-13T00:00:00Z"},
+		{"0 0 1-31 * 5", "2026-10-10T00:00:00Z", "2026-10-16T00:00:00Z"},
+		{"0 0 */1 * 1-5", "2026-10-16T10:00:00Z", "2026-10-19T00:00:00Z"},
+		// Evaluated in UTC: 13:30 at +02:00 is 11:30 UTC, before the noon tick
+		{"0 12 * * *", "2026-10-16T13:30:00+02:00", "2026-10-16T12:00:00Z"},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		got := schedule.next(utc(tt.after))
+		if !got.Equal(utc(tt.want)) {
+			t.Errorf("%q after %s: got %s, want %s", tt.expr, tt.after, got.Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestCronNextNeverMatching(t *testing.T) {
+	schedule, err := parseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := schedule.next(utc("2026-10-16T00:00:00Z")); !got.IsZero() {
+		t.Errorf("31 February: got %s, want zero", got)
+	}
+}
+
+func TestCronDescribe(t *testing.T) {
+	tests := map[string]string{
+		"*/5 * * * *":  "Every 5 minutes",
+		"*/15 * * * *": "Every 15 minutes",
+		"* * * * *":    "Every minute",
+		"*/7 * * * *":  "Cron */7 * * * * (UTC)", // Resets on the hour, not evenly spaced
+		"0 * * * *":    "Cron 0 * * * * (UTC)",
+	}
+	for expr, want := range tests {
+		schedule, err := parseCron(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schedule.describe(); got != want {
+			t.Errorf("%q: got %q, want %q", expr, got, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import "strconv"
+
+// Rank movement between consecutive runs
+const (
+	MovementUp      = "up"
+	MovementDown    = "down"
+	MovementSame    = "same"
+	MovementNew     = "new"
+	MovementDropped = "dropped"
+)
+
+// RankChange describes how one coin moved in a metric since the previous run
+type RankChange struct {
+	ID           int      `json:"id,omitempty"`
+	Symbol       string   `json:"symbol"`
+	Name         string   `json:"name"`
+	Movement     string   `json:"movement"`
+	Rank         int      `json:"rank,omitempty"`          // 0 when dropped
+	PreviousRank int      `json:"previous_rank,omitempty"` // 0 when new
+	RankDelta    int      `json:"rank_delta"`              // Positive means the coin moved up
+	ValueDelta   *float64 `json:"value_delta,omitempty"`   // Raw value change, when both runs have one
+}
+
+func rankOf(crypto CryptoData, index int) int {
+	if crypto.Rank > 0 {
+		return crypto.Rank
+	}
+	return index + 1
+}
+
+// Coins are matched by ID, since several coins can share a symbol. Runs
+// stored before IDs were recorded fall back to matching by symbol.
+func coinKeyFunc(current, previous []CryptoData) func(CryptoData) string {
+	for _, list := range [][]CryptoData{current, previous} {
+		for _, crypto := range list {
+			if crypto.ID == 0 {
+				return func(crypto CryptoData) string { return "symbol:" + crypto.Symbol }
+			}
+		}
+	}
+	return func(crypto CryptoData) string { return "id:" + strconv.Itoa(crypto.ID) }
+}
+
+// Compare one metric's ranking against the previous run's ranking. A coin
+// missing from the current run only counts as dropped when its previous rank
+// is within the current run's depth; a shallower run (a smaller limit)
+// says nothing about the coins below it.
+func computeRankChanges(current, previous []CryptoData) []RankChange {
+	coinKey := coinKeyFunc(current, previous)
+	previousByKey := make(map[string]int, len(previous))
+	for i, crypto := range previous {
+		previousByKey[coinKey(crypto)] = i
+	}
+
+	changes := make([]RankChange, 0, len(current)+len(previous))
+	seen := make(map[string]bool, len(current))
+
+	for i, crypto := range current {
+		key := coinKey(crypto)
+		seen[key] = true
+		change := RankChange{
+			ID:     crypto.ID,
+			Symbol: crypto.Symbol,
+			Name:   crypto.Name,
+			Rank:   rankOf(crypto, i),
+		}
+
+		j, existed := previousByKey[key]
+		if !existed {
+			change.Movement = MovementNew
+			changes = append(changes, change)
+			continue
+		}
+
+		before := previous[j]
+		change.PreviousRank = rankOf(before, j)
+		change.RankDelta = change.PreviousRank - change.Rank
+		switch {
+		case change.RankDelta > 0:
+			change.Movement = MovementUp
+		case change.RankDelta < 0:
+			change.Movement = MovementDown
+		default:
+			change.Movement = MovementSame
+		}
+
+		if crypto.RawValue != nil && before.RawValue != nil {
+			delta := *crypto.RawValue - *before.RawValue
+			change.ValueDelta = &delta
+		}
+		changes = append(changes, change)
+	}
+
+	for j, crypto := range previous {
+		previousRank := rankOf(crypto, j)
+		if seen[coinKey(crypto)] || previousRank > len(current) {
+			continue
+		}
+		changes = append(changes, RankChange{
+			ID:           crypto.ID,
+			Symbol:       crypto.Symbol,
+			Name:         crypto.Name,
+			Movement:     MovementDropped,
+			PreviousRank: previousRank,
+			RankDelta:    -previousRank,
+		})
+	}
+
+	return changes
+}
+
+// Fill MetricData.Changes for every metric that succeeded in both runs
+func applyRankChanges(current *CryptoDataResponse, previous CryptoDataResponse) {
+	comparedTo := previous.Timestamp
+	for sortType, metricData := range current.AllMetrics {
+		if !metricData.Success {
+			continue
+		}
+		previousData, exists := previous.AllMetrics[sortType]
+		if !exists || !previousData.Success {
+			continue
+		}
+
+		metricData.Changes = computeRankChanges(metricData.AllData, previousData.AllData)
+		metricData.ComparedTo = &comparedTo
+		current.AllMetrics[sortType] = metricData
+	}
+}
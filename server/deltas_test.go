@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func ranked(symbols ...string) []CryptoData {
+	data := make([]CryptoData, len(symbols))
+	for i, symbol := range symbols {
+		value := float64(100 - i)
+		data[i] = CryptoData{Symbol: symbol, Name: symbol, Rank: i + 1, RawValue: &value}
+	}
+	return data
+}
+
+func TestComputeRankChanges(t *testing.T) {
+	previous := ranked("BTC", "ETH", "SOL", "XRP")
+	current := ranked("ETH", "BTC", "SOL", "DOGE")
+
+	changes := computeRankChanges(current, previous)
+	want := []RankChange{
+		{Symbol: "ETH", Movement: MovementUp, Rank: 1, PreviousRank: 2, RankDelta: 1},
+		{Symbol: "BTC", Movement: MovementDown, Rank: 2, PreviousRank: 1, RankDelta: -1},
+		{Symbol: "SOL", Movement: MovementSame, Rank: 3, PreviousRank: 3, RankDelta: 0},
+		{Symbol: "DOGE", Movement: MovementNew, Rank: 4},
+		{Symbol: "XRP", Movement: MovementDropped, PreviousRank: 4, RankDelta: -4},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		got := changes[i]
+		if got.Symbol != w.Symbol || got.Movement != w.Movement || got.Rank != w.Rank ||
+			got.PreviousRank != w.PreviousRank || got.RankDelta != w.RankDelta {
+			t.Errorf("change %d: got %+v, want %+v", i, got, w)
+		}
+	}
+
+	// ETH went from 99 at rank 2 to 100 at rank 1
+	if eth := changes[0]; eth.ValueDelta == nil || *eth.ValueDelta != 1 {
+		t.Errorf("ETH value delta: got %v, want 1", eth.ValueDelta)
+	}
+	if doge := changes[3]; doge.ValueDelta != nil {
+		t.Errorf("new coin has a value delta: %v", *doge.ValueDelta)
+	}
+}
+
+func TestComputeRankChangesWithoutStoredRanks(t *testing.T) {
+	// Runs stored before ranks existed fall back to list position
+	previous := []CryptoData{{Symbol: "BTC"}, {Symbol: "ETH"}}
+	current := []CryptoData{{Symbol: "ETH"}, {Symbol: "BTC"}}
+
+	changes := computeRankChanges(current, previous)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	if changes[0].Movement != MovementUp || changes[0].Rank != 1 || changes[0].PreviousRank != 2 {
+		t.Errorf("ETH: got %+v, want up from 2 to 1", changes[0])
+	}
+	if changes[1].Movement != MovementDown || changes[1].ValueDelta != nil {
+		t.Errorf("BTC: got %+v, want down with no value delta", changes[1])
+	}
+}
+
+func TestComputeRankChangesFirstRun(t *testing.T) {
+	changes := computeRankChanges(ranked("BTC", "ETH"), nil)
+	for _, change := range changes {
+		if change.Movement != MovementNew {
+			t.Errorf("%s: %s, want new", change.Symbol, change.Movement)
+		}
+	}
+	if changes := computeRankChanges(nil, ranked("BTC")); len(changes) != 0 {
+		t.Errorf("empty run: got %+v, want no changes", changes)
+	}
+}
+
+func TestComputeRankChangesShallowerRun(t *testing.T) {
+	// A run with a smaller limit only drops coins within its own depth
+	previous := ranked("BTC", "ETH", "SOL", "XRP", "DOGE")
+	current := ranked("BTC", "SOL")
+
+	changes := computeRankChanges(current, previous)
+	var dropped []string
+	for _, change := range changes {
+		if change.Movement == MovementDropped {
+			dropped = append(dropped, change.Symbol)
+		}
+	}
+	if len(dropped) != 1 || dropped[0] != "ETH" {
+		t.Errorf("dropped %v, want [ETH]", dropped)
+	}
+}
+
+func TestComputeRankChangesDuplicateSymbols(t *testing.T) {
+	previous := []CryptoData{{ID: 1, Symbol: "PEPE", Rank: 1}, {ID: 2, Symbol: "PEPE", Rank: 2}}
+	current := []CryptoData{{ID: 2, Symbol: "PEPE", Rank: 1}, {ID: 1, Symbol: "PEPE", Rank: 2}}
+
+	changes := computeRankChanges(current, previous)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2: %+v", len(changes), changes)
+	}
+	if changes[0].ID != 2 || changes[0].Movement != MovementUp || changes[0].PreviousRank != 2 {
+		t.Errorf("coin 2: got %+v, want up from 2", changes[0])
+	}
+	if changes[1].ID != 1 || changes[1].Movement != MovementDown || changes[1].PreviousRank != 1 {
+		t.Errorf("coin 1: got %+v, want down from 1", changes[1])
+	}
+}
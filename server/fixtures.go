@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Fixture files hold the raw LunarCrush JSON for one sort key: <dir>/<sort>.json.
+// Pages of a ranking (universe mode) are kept apart in <dir>/<sort>.page-<n>.json.
+
+func fixturePath(dir, sort string) string {
+	return filepath.Join(dir, sort+".json")
+}
+
+func fixturePagePath(dir, sort string, page int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.page-%d.json", sort, page))
+}
+
+// Write to a temp file first so a concurrent replay never sees half a fixture
+func writeFixture(path string, body []byte) {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		log.Printf("❌ Failed to record fixture %s: %v", path, err)
+	} else if err := os.Rename(tmp, path); err != nil {
+		log.Printf("❌ Failed to record fixture %s: %v", path, err)
+	}
+}
+
+// RecordingProvider calls LunarCrush and saves each raw response as a fixture
+type RecordingProvider struct {
+	live *LunarCrushProvider
+	dir  string
+}
+
+func newRecordingProvider(live *LunarCrushProvider, dir string) (*RecordingProvider, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create fixture dir %s: %w", dir, err)
+	}
+	log.Printf("📼 Recording LunarCrush responses to %s", dir)
+	return &RecordingProvider{live: live, dir: dir}, nil
+}
+
+func (p *RecordingProvider) Name() string {
+	return p.live.Name() + "+record"
+}
+
+func (p *RecordingProvider) QuotaStatus() QuotaStatus {
+	return p.live.QuotaStatus()
+}
+
+func (p *RecordingProvider) ListCoins(ctx context.Context, sort string, limit int) ([]LunarCrushCoin, error) {
+	body, err := p.live.fetchRaw(ctx, sort, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	writeFixture(fixturePath(p.dir, sort), body)
+	return decodeLunarCrushResponse(body)
+}
+
+// ListCoinsPage records each page to its own file, so universe mode never
+// overwrites the per-metric fixture for the same sort key
+func (p *RecordingProvider) ListCoinsPage(ctx context.Context, sort string, page, pageSize int) ([]LunarCrushCoin, error) {
+	body, err := p.live.fetchPageRaw(ctx, sort, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	writeFixture(fixturePagePath(p.dir, sort, page), body)
+	return decodeLunarCrushResponse(body)
+}
+
+// FixtureProvider replays recorded responses from disk, for offline runs and tests
+type FixtureProvider struct {
+	dir string
+}
+
+func newFixtureProvider(dir string) *FixtureProvider {
+	log.Printf("📼 Replaying fixtures from %s", dir)
+	return &FixtureProvider{dir: dir}
+}
+
+func (p *FixtureProvider) Name() string {
+	return "fixture"
+}
+
+func (p *FixtureProvider) ListCoins(ctx context.Context, sort string, limit int) ([]LunarCrushCoin, error) {
+	path := fixturePath(p.dir, sort)
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for sort %q: %w", sort, err)
+	}
+
+	coins, err := decodeLunarCrushResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", path, err)
+	}
+
+	if limit > 0 && limit < len(coins) {
+		coins = coins[:limit]
+	}
+	return coins, nil
+}
+
+// ListCoinsPage replays a recorded page. Without one, the page is cut from
+// the sort key's fixture, so per-metric recordings also work in universe mode.
+func (p *FixtureProvider) ListCoinsPage(ctx context.Context, sort string, page, pageSize int) ([]LunarCrushCoin, error) {
+	path := fixturePagePath(p.dir, sort, page)
+	body, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		coins, err := p.ListCoins(ctx, sort, 0)
+		if err != nil {
+			return nil, err
+		}
+		start := min(page*pageSize, len(coins))
+		return coins[start:min(start+pageSize, len(coins))], nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", path, err)
+	}
+
+	coins, err := decodeLunarCrushResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", path, err)
+	}
+
+	if pageSize > 0 && pageSize < len(coins) {
+		coins = coins[:pageSize]
+	}
+	return coins, nil
+}
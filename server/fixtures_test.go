@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRecordingProviderKeepsPagesApart(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		symbol := "LIST"
+		if page := r.URL.Query().Get("page"); page != "" {
+			symbol = "PAGE" + page
+		}
+		fmt.Fprintf(w, `{"data":[{"id":1,"symbol":%q,"name":"Coin"}]}`, symbol)
+	}))
+	defer upstream.Close()
+
+	live := newLunarCrushProvider("test-key")
+	live.baseURL = upstream.URL
+	dir := t.TempDir()
+	recorder, err := newRecordingProvider(live, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := recorder.ListCoins(ctx, "market_cap", 10); err != nil {
+		t.Fatal(err)
+	}
+	coins, err := fetchUniverse(ctx, recorder, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(coins) != 1 || coins[0].Symbol != "PAGE0" {
+		t.Fatalf("universe fetched %+v, want one coin from page 0", coins)
+	}
+
+	replay := newFixtureProvider(dir)
+	listed, err := replay.ListCoins(ctx, "market_cap", 0)
+	if err != nil || len(listed) != 1 || listed[0].Symbol != "LIST" {
+		t.Fatalf("market_cap fixture replayed %+v (%v), want the ListCoins recording", listed, err)
+	}
+	paged, err := replay.ListCoinsPage(ctx, "market_cap", 0, 10)
+	if err != nil || len(paged) != 1 || paged[0].Symbol != "PAGE0" {
+		t.Fatalf("page fixture replayed %+v (%v), want the page recording", paged, err)
+	}
+	if _, err := os.Stat(fixturePagePath(dir, "market_cap", 0)); err != nil {
+		t.Fatalf("page fixture not written: %v", err)
+	}
+}
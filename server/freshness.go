@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// crypto:latest is kept for SNAPSHOT_RETENTION, well past the point where it
+// is fresh, so a stalled refresh shows up as stale data rather than a 404.
+// What happens to stale data is set by STALENESS_POLICY:
+//
+//	serve  (default) return it with a warning and Warning header
+//	reject           return 503 with Retry-After until a refresh lands
+const (
+	StalenessPolicyServe  = "serve"
+	StalenessPolicyReject = "reject"
+)
+
+var (
+	stalenessPolicy = StalenessPolicyServe
+	freshFor        = 15 * time.Minute // DATA_FRESH_FOR
+)
+
+// Freshness describes how old the served data is. A run can carry over
+// metrics from earlier runs (a partial refresh, or last good data for a failed
+// fetch), so the age is that of the oldest metric data, not of the run.
+type Freshness struct {
+	AgeSeconds          int64     `json:"age_seconds"`
+	OldestMetric        string    `json:"oldest_metric,omitempty"` // Set when older than the run itself
+	Stale               bool      `json:"stale"`
+	FreshForSeconds     int64     `json:"fresh_for_seconds"`
+	NextExpectedRefresh time.Time `json:"next_expected_refresh"`
+	Warning             string    `json:"warning,omitempty"`
+}
+
+// CryptoDataWithFreshness is the /api/crypto/data payload
+type CryptoDataWithFreshness struct {
+	CryptoDataResponse
+	Freshness Freshness `json:"freshness"`
+}
+
+func initFreshnessConfig() {
+	if policy := os.Getenv("STALENESS_POLICY"); policy != "" {
+		if policy != StalenessPolicyServe && policy != StalenessPolicyReject {
+			log.Fatalf("Unknown STALENESS_POLICY %q (use %s or %s)", policy, StalenessPolicyServe, StalenessPolicyReject)
+		}
+		stalenessPolicy = policy
+	}
+	freshFor = durationFromEnv("DATA_FRESH_FOR", freshFor)
+	log.Printf("✅ Data fresh for %s, staleness policy: %s", freshFor, stalenessPolicy)
+}
+
+// When the next run should land: the first REFRESH_CRON tick after this run,
+// or the next upcoming tick if that has already passed
+func nextExpectedRefresh(last, now time.Time) time.Time {
+	next := refreshSchedule.next(last)
+	if next.Before(now) {
+		next = refreshSchedule.next(now)
+	}
+	return next
+}
+
+// The oldest fetch time among the run's metrics, and which metric it is.
+// Metrics without UpdatedAt count as fetched with the run. Last good data kept
+// for a failed fetch is left out: it is already flagged stale on its own.
+func oldestMetricData(data CryptoDataResponse) (time.Time, string) {
+	oldest, oldestMetric := data.Timestamp, ""
+	for sortType, metricData := range data.AllMetrics {
+		if metricData.Success && !metricData.Stale && metricData.UpdatedAt != nil && metricData.UpdatedAt.Before(oldest) {
+			oldest, oldestMetric = *metricData.UpdatedAt, sortType
+		}
+	}
+	return oldest, oldestMetric
+}
+
+func freshnessOf(data CryptoDataResponse, now time.Time) Freshness {
+	updatedAt, oldestMetric := oldestMetricData(data)
+	age := now.Sub(updatedAt)
+	freshness := Freshness{
+		AgeSeconds:          int64(age.Seconds()),
+		OldestMetric:        oldestMetric,
+		Stale:               age > freshFor,
+		FreshForSeconds:     int64(freshFor.Seconds()),
+		NextExpectedRefresh: nextExpectedRefresh(data.Timestamp, now),
+	}
+	switch {
+	case freshness.Stale && oldestMetric != "":
+		freshness.Warning = fmt.Sprintf("%s data is %s old; it may not have been refreshed", oldestMetric, age.Round(time.Second))
+	case freshness.Stale:
+		freshness.Warning = fmt.Sprintf("Data is %s old; refreshes may be stalled", age.Round(time.Second))
+	}
+	return freshness
+}
+
+// Bring per-metric stale ages up to date at serve time
+func withCurrentStaleAges(data CryptoDataResponse, now time.Time) CryptoDataResponse {
+	metrics := make(map[string]MetricData, len(data.AllMetrics))
+	for sortType, metricData := range data.AllMetrics {
+		if metricData.Stale && metricData.UpdatedAt != nil {
+			metricData.StaleAgeSecs = int64(now.Sub(*metricData.UpdatedAt).Seconds())
+		}
+		metrics[sortType] = metricData
+	}
+	data.AllMetrics = metrics
+	return data
+}
+
+// GET /api/crypto/data
+func serveCryptoData(c *gin.Context) {
+	data, exists := getLatestDataFromRedis()
+	if !exists {
+		c.JSON(404, gin.H{
+			"error":          "No crypto data available yet",
+			"message":        "Data is updated on schedule: " + refreshSchedule.describe(),
+			"manual_trigger": "POST /dev/trigger",
+		})
+		return
+	}
+
+	now := time.Now()
+	freshness := freshnessOf(data, now)
+	c.Header("Age", strconv.FormatInt(max(freshness.AgeSeconds, 0), 10))
+
+	if freshness.Stale {
+		retryAfter := max(int64(freshness.NextExpectedRefresh.Sub(now).Seconds()), 1)
+		if stalenessPolicy == StalenessPolicyReject {
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			c.JSON(503, gin.H{
+				"error":     "Crypto data is stale",
+				"message":   freshness.Warning,
+				"freshness": freshness,
+			})
+			return
+		}
+		c.Header("Warning", `110 - "Response is Stale"`)
+	}
+
+	c.JSON(200, CryptoDataWithFreshness{
+		CryptoDataResponse: withCurrentStaleAges(data, now),
+		Freshness:          freshness,
+	})
+}
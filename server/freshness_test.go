@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreshnessCountsCarriedOverMetrics(t *testing.T) {
+	schedule, err := parseCron("*/5 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshSchedule = schedule
+
+	now := time.Now()
+	hoursAgo := now.Add(-3 * time.Hour)
+	justNow := now.Add(-time.Minute)
+	data := CryptoDataResponse{
+		Timestamp: justNow,
+		AllMetrics: map[string]MetricData{
+			"price":      {Success: true, UpdatedAt: &justNow},
+			"volume_24h": {Success: true, UpdatedAt: &hoursAgo}, // Carried over by a partial refresh
+		},
+	}
+
+	freshness := freshnessOf(data, now)
+	if !freshness.Stale || freshness.OldestMetric != "volume_24h" || freshness.AgeSeconds < 3*3600 {
+		t.Errorf("got %+v, want stale because of volume_24h", freshness)
+	}
+
+	// Last good data for a failed fetch is flagged per metric instead
+	volume := data.AllMetrics["volume_24h"]
+	volume.Stale = true
+	data.AllMetrics["volume_24h"] = volume
+	if freshness := freshnessOf(data, now); freshness.Stale || freshness.OldestMetric != "" {
+		t.Errorf("got %+v, want fresh", freshness)
+	}
+}
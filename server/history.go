@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// HistoryPoint is one coin's position in a metric ranking for a single run.
+// Rank and RawValue are nil when the coin wasn't in that run's ranking.
+type HistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     string    `json:"value,omitempty"`
+	RawValue  *float64  `json:"raw_value"`
+	Rank      *int      `json:"rank"`
+}
+
+type CoinHistory struct {
+	ID       int            `json:"id"`
+	Symbol   string         `json:"symbol"`
+	Name     string         `json:"name,omitempty"`
+	Metric   string         `json:"metric"`
+	Unit     string         `json:"unit,omitempty"`
+	Currency string         `json:"currency,omitempty"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Interval string         `json:"interval,omitempty"`
+	Points   []HistoryPoint `json:"points"`
+	Count    int            `json:"count"`
+}
+
+// At most this many points are returned. A range holding more snapshots has
+// its interval widened so that it fits.
+const historyMaxPoints = 300
+
+// Snapshots tried per interval bucket, newest first, to find one that ranks
+// the coin
+const historyBucketScan = 3
+
+// Build a coin's time series for one metric from stored snapshots. The coin
+// is matched by ID; symbol only matches snapshots stored before IDs were.
+// With a non-zero interval, each bucket keeps its latest point that ranks the
+// coin, or its latest point when none of the snapshots tried do.
+func getCoinHistory(id int, symbol, metric string, from, to time.Time, interval time.Duration) (CoinHistory, error) {
+	history := CoinHistory{
+		ID:     id,
+		Symbol: strings.ToUpper(symbol),
+		Metric: metric,
+		From:   from.UTC(),
+		To:     to.UTC(),
+		Points: []HistoryPoint{},
+	}
+
+	infos, err := listSnapshots(from, to, 0)
+	if err != nil {
+		return history, err
+	}
+
+	if len(infos) > historyMaxPoints {
+		interval = max(interval, minHistoryInterval(from, to))
+	}
+	if interval > 0 {
+		history.Interval = interval.String()
+	}
+
+	buckets := bucketSnapshots(infos, interval)
+	points := make([]*HistoryPoint, len(buckets))
+	resolved := make([]bool, len(buckets))
+
+	// Each pass reads the next-newest snapshot of every bucket still without a ranked point
+	for pass := 0; pass < historyBucketScan; pass++ {
+		var wanted []SnapshotInfo
+		var owners []int
+		for b, bucket := range buckets {
+			if !resolved[b] && pass < len(bucket) {
+				wanted = append(wanted, bucket[len(bucket)-1-pass])
+				owners = append(owners, b)
+			}
+		}
+		if len(wanted) == 0 {
+			break
+		}
+
+		results, err := getSnapshotMetric(wanted, metric)
+		if err != nil {
+			return history, err
+		}
+
+		for i, result := range results {
+			if !result.Loaded {
+				continue
+			}
+			b := owners[i]
+			point := coinHistoryPoint(&history, result)
+			if points[b] == nil || point.Rank != nil {
+				points[b] = &point
+			}
+			resolved[b] = point.Rank != nil
+		}
+	}
+
+	for _, point := range points {
+		if point != nil {
+			history.Points = append(history.Points, *point)
+		}
+	}
+
+	history.Count = len(history.Points)
+	return history, nil
+}
+
+// Smallest whole-minute interval that splits from..to into historyMaxPoints buckets
+func minHistoryInterval(from, to time.Time) time.Duration {
+	interval := to.Sub(from) / time.Duration(historyMaxPoints-1)
+	return (interval + time.Minute - 1).Truncate(time.Minute)
+}
+
+// Group snapshots (oldest first) by interval; every snapshot is its own
+// bucket when interval is zero
+func bucketSnapshots(infos []SnapshotInfo, interval time.Duration) [][]SnapshotInfo {
+	var buckets [][]SnapshotInfo
+	for i, info := range infos {
+		if interval > 0 && i > 0 {
+			last := &buckets[len(buckets)-1]
+			if (*last)[0].Timestamp.Truncate(interval).Equal(info.Timestamp.Truncate(interval)) {
+				*last = append(*last, info)
+				continue
+			}
+		}
+		buckets = append(buckets, []SnapshotInfo{info})
+	}
+	return buckets
+}
+
+// The coin's point in one snapshot; Rank stays nil when the metric isn't
+// ranked there or doesn't include the coin
+func coinHistoryPoint(history *CoinHistory, result snapshotMetric) HistoryPoint {
+	point := HistoryPoint{Timestamp: result.Timestamp.UTC()}
+
+	metricData := result.Metric
+	if metricData == nil || !metricData.Success || metricData.Stale { // Stale data repeats an older point
+		return point
+	}
+
+	history.Unit = metricData.Unit
+	history.Currency = metricData.Currency
+	for i, crypto := range metricData.AllData {
+		if !isCoin(crypto, history.ID, history.Symbol) {
+			continue
+		}
+		rank := crypto.Rank
+		if rank == 0 {
+			rank = i + 1 // snapshots stored before ranks were recorded
+		}
+		point.Rank = &rank
+		point.Value = crypto.Value
+		point.RawValue = crypto.RawValue
+		history.Name = crypto.Name
+		history.Symbol = crypto.Symbol
+		break
+	}
+	return point
+}
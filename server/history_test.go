@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Coin IDs for the symbols used in these tests
+var historyCoinIDs = map[string]int{"BTC": 1, "ETH": 2, "SOL": 3}
+
+func storeHistorySnapshot(at time.Time, symbols ...string) {
+	data := make([]CryptoData, len(symbols))
+	for i, symbol := range symbols {
+		value := float64(100 - i)
+		data[i] = CryptoData{ID: historyCoinIDs[symbol], Name: symbol, Symbol: symbol, Sort: "market_cap", RawValue: &value, Rank: i + 1}
+	}
+	storeHistoryData(at, data)
+}
+
+func storeHistoryData(at time.Time, data []CryptoData) {
+	storeSnapshotInRedis(CryptoDataResponse{
+		Timestamp: at,
+		AllMetrics: map[string]MetricData{
+			"market_cap": {Name: "Market Cap", Success: true, DataCount: len(data), AllData: data},
+		},
+	})
+}
+
+func TestCoinHistoryBucketPrefersRankedPoint(t *testing.T) {
+	store = newFailoverStore(nil)
+	base := time.Now().Truncate(time.Hour).Add(-2 * time.Hour)
+
+	storeHistorySnapshot(base.Add(5*time.Minute), "BTC", "ETH")
+	storeHistorySnapshot(base.Add(10*time.Minute), "ETH", "BTC")
+	storeHistorySnapshot(base.Add(15*time.Minute), "ETH") // BTC missing from the bucket's latest run
+
+	history, err := getCoinHistory(1, "BTC", "market_cap", base, base.Add(time.Hour), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Count != 1 {
+		t.Fatalf("got %d points, want 1", history.Count)
+	}
+	point := history.Points[0]
+	if point.Rank == nil || *point.Rank != 2 || !point.Timestamp.Equal(base.Add(10*time.Minute).UTC()) {
+		t.Fatalf("got rank %v at %s, want rank 2 from the 10-minute run", point.Rank, point.Timestamp)
+	}
+}
+
+func TestCoinHistoryCapsPoints(t *testing.T) {
+	store = newFailoverStore(nil)
+	base := time.Now().Add(-20 * time.Hour).Truncate(time.Hour)
+
+	for i := 0; i < historyMaxPoints+50; i++ {
+		storeHistorySnapshot(base.Add(time.Duration(i)*time.Minute), "BTC")
+	}
+
+	to := base.Add(time.Duration(historyMaxPoints+50) * time.Minute)
+	history, err := getCoinHistory(1, "BTC", "market_cap", base, to, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Count > historyMaxPoints || history.Interval == "" {
+		t.Fatalf("got %d points with interval %q, want at most %d and a widened interval", history.Count, history.Interval, historyMaxPoints)
+	}
+}
+
+func TestCoinHistoryMatchesByID(t *testing.T) {
+	store = newFailoverStore(nil)
+	base := time.Now().Truncate(time.Hour).Add(-2 * time.Hour)
+
+	// Two coins share the ticker; only the ID tells them apart
+	one, two := 100.0, 5.0
+	storeHistoryData(base.Add(5*time.Minute), []CryptoData{
+		{ID: 10, Name: "Real", Symbol: "DUP", RawValue: &one, Rank: 1},
+		{ID: 20, Name: "Copycat", Symbol: "DUP", RawValue: &two, Rank: 2},
+	})
+
+	history, err := getCoinHistory(20, "DUP", "market_cap", base, base.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Count != 1 || history.Name != "Copycat" || *history.Points[0].Rank != 2 {
+		t.Errorf("got %s with %+v, want the Copycat's rank 2", history.Name, history.Points)
+	}
+}
+
+func TestResolveCoin(t *testing.T) {
+	store = newFailoverStore(nil)
+	latest := CryptoDataResponse{Timestamp: time.Now(), AllMetrics: map[string]MetricData{
+		"market_cap": {Success: true, AllData: []CryptoData{
+			{ID: 1, Symbol: "BTC"}, {ID: 10, Symbol: "DUP"}, {ID: 20, Symbol: "DUP"},
+		}},
+	}}
+	if !storeLatestDataInRedis(latest) {
+		t.Fatal("failed to store latest data")
+	}
+
+	if id, symbol, err := resolveCoin("btc"); err != nil || id != 1 || symbol != "BTC" {
+		t.Errorf("btc: %d %q %v, want 1", id, symbol, err)
+	}
+	if id, symbol, err := resolveCoin("20"); err != nil || id != 20 || symbol != "DUP" {
+		t.Errorf("20: %d %q %v, want coin 20", id, symbol, err)
+	}
+	var ambiguous errAmbiguousSymbol
+	if _, _, err := resolveCoin("DUP"); !errors.As(err, &ambiguous) || len(ambiguous.ids) != 2 {
+		t.Errorf("DUP: %v, want an ambiguous symbol error with both IDs", err)
+	}
+	if _, _, err := resolveCoin("NOPE"); !errors.Is(err, errCoinNotFound) {
+		t.Errorf("NOPE: %v, want errCoinNotFound", err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/inngest/inngestgo"
+)
+
+// Only one pipeline run at a time, across every instance and both schedulers.
+// Each run takes a fencing token from an ever-increasing counter and holds the
+// lock under that token. The token becomes the run's generation, and
+// crypto:latest is only written with a generation at least as new as the one
+// already there, so a run that lost its lock (expired mid-run, or Redis
+// failed over) can never overwrite a newer snapshot.
+const (
+	pipelineLockKey   = "crypto:pipeline:lock"
+	pipelineFenceKey  = "crypto:pipeline:fence"
+	pipelineRunPrefix = "crypto:pipeline:run:" // Inngest run ID -> token, to release the lock if the run fails
+)
+
+// How long a run may hold the lock without renewing it (PIPELINE_LOCK_TTL)
+var pipelineLockTTL = 15 * time.Minute
+
+func initPipelineLockConfig() {
+	pipelineLockTTL = durationFromEnv("PIPELINE_LOCK_TTL", pipelineLockTTL)
+}
+
+// PipelineLease is the outcome of trying to take the pipeline lock. It is a
+// step result, so it has to survive a JSON round trip.
+type PipelineLease struct {
+	Acquired   bool      `json:"acquired"`
+	AcquiredAt time.Time `json:"acquired_at"`       // Start of the run, for its wall-clock duration
+	Token      int64     `json:"token"`             // Fencing token, used as the run's generation
+	HeldBy     int64     `json:"held_by,omitempty"` // Token of the run holding the lock when not acquired
+}
+
+func acquirePipelineLock(ctx context.Context) (PipelineLease, error) {
+	// Never below the generation of the stored data, so a fence counter that
+	// was lost or reset can't hand out tokens that lose every SetIfNewer
+	token, err := store.IncrFrom(ctx, pipelineFenceKey, generationKey("crypto:latest"))
+	if err != nil {
+		return PipelineLease{}, err
+	}
+	acquired, err := store.SetNX(ctx, pipelineLockKey, strconv.FormatInt(token, 10), pipelineLockTTL)
+	if err != nil {
+		return PipelineLease{}, err
+	}
+	if !acquired {
+		holder, _ := pipelineLockHolder(ctx)
+		return PipelineLease{HeldBy: holder}, nil
+	}
+	if runID := pipelineRunID(ctx); runID != "" {
+		if err := store.Set(ctx, pipelineRunPrefix+runID, strconv.FormatInt(token, 10), pipelineLockTTL); err != nil {
+			log.Printf("⚠️  Failed to record the lock for run %s, a failure will hold it for %s: %v", runID, pipelineLockTTL, err)
+		}
+	}
+	log.Printf("🔒 Pipeline lock acquired (generation %d)", token)
+	return PipelineLease{Acquired: true, AcquiredAt: time.Now(), Token: token}, nil
+}
+
+// Extend the lock; false means it expired and may belong to another run now
+func renewPipelineLock(ctx context.Context, token int64) bool {
+	renewed, err := store.CompareAndExpire(ctx, pipelineLockKey, strconv.FormatInt(token, 10), pipelineLockTTL)
+	if err != nil {
+		log.Printf("⚠️  Failed to renew pipeline lock: %v", err)
+	}
+	return renewed
+}
+
+func releasePipelineLock(ctx context.Context, token int64) {
+	released, err := store.CompareAndDelete(ctx, pipelineLockKey, strconv.FormatInt(token, 10))
+	switch {
+	case err != nil:
+		log.Printf("⚠️  Failed to release pipeline lock, it expires in %s: %v", pipelineLockTTL, err)
+	case released:
+		log.Printf("🔓 Pipeline lock released (generation %d)", token)
+	}
+	if runID := pipelineRunID(ctx); runID != "" {
+		_ = store.Del(ctx, pipelineRunPrefix+runID)
+	}
+}
+
+// Token of the run currently holding the lock; false when nobody holds it
+func pipelineLockHolder(ctx context.Context) (int64, bool) {
+	value, err := store.Get(ctx, pipelineLockKey)
+	if err != nil {
+		return 0, false
+	}
+	token, err := strconv.ParseInt(value, 10, 64)
+	return token, err == nil
+}
+
+// Renew the lock every third of its TTL until ctx is done. Only direct runs
+// use this; an Inngest run spans several requests, so it relies on the TTL.
+func keepPipelineLock(ctx context.Context, token int64) {
+	ticker := time.NewTicker(pipelineLockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !renewPipelineLock(ctx, token) {
+				log.Printf("⚠️  Pipeline lock (generation %d) was lost; a newer run's data will win", token)
+				return
+			}
+		}
+	}
+}
+
+type pipelineRunKey struct{}
+
+// Tag ctx with the Inngest run ID, so the lock can be found again if the run fails
+func withPipelineRun(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, pipelineRunKey{}, runID)
+}
+
+func pipelineRunID(ctx context.Context) string {
+	runID, _ := ctx.Value(pipelineRunKey{}).(string)
+	return runID
+}
+
+// Data of the inngest/function.failed event
+type functionFailedData struct {
+	FunctionID string `json:"function_id"`
+	RunID      string `json:"run_id"`
+}
+
+// Inngest function that releases the lock of a pipeline run that failed for
+// good (retries exhausted, or an error outside a step), instead of leaving it
+// held until PIPELINE_LOCK_TTL. Runs that are still retrying keep the lock.
+func createLockReleaseFunction(client inngestgo.Client, pipelines ...inngestgo.ServableFunction) (inngestgo.ServableFunction, error) {
+	matches := make([]string, len(pipelines))
+	for i, fn := range pipelines {
+		matches[i] = fmt.Sprintf("event.data.function_id == %q", fn.FullyQualifiedID())
+	}
+
+	return inngestgo.CreateFunction(
+		client,
+		inngestgo.FunctionOpts{
+			ID: "release-pipeline-lock",
+		},
+		inngestgo.EventTrigger("inngest/function.failed", inngestgo.StrPtr(strings.Join(matches, " || "))),
+		func(ctx context.Context, input inngestgo.Input[functionFailedData]) (any, error) {
+			return releaseFailedRunLock(ctx, input.Event.Data)
+		},
+	)
+}
+
+// Release the lock recorded for a failed run, if it still holds one
+func releaseFailedRunLock(ctx context.Context, failed functionFailedData) (any, error) {
+	runID := failed.RunID
+	value, err := store.Get(ctx, pipelineRunPrefix+runID)
+	if errors.Is(err, ErrNotFound) {
+		return gin.H{"released": false, "reason": "run held no lock"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	token, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad lock token for run %s: %w", runID, err)
+	}
+
+	log.Printf("❌ Pipeline run %s (%s) failed, releasing its lock", runID, failed.FunctionID)
+	releasePipelineLock(withPipelineRun(ctx, runID), token)
+	return gin.H{"released": true, "generation": token}, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestReleaseFailedRunLock(t *testing.T) {
+	store = newFailoverStore(nil)
+	ctx := context.Background()
+
+	lease, err := acquirePipelineLock(withPipelineRun(ctx, "run-1"))
+	if err != nil || !lease.Acquired {
+		t.Fatalf("acquire: %+v, %v", lease, err)
+	}
+
+	// Another run failing doesn't touch the lock
+	if _, err := releaseFailedRunLock(ctx, functionFailedData{RunID: "run-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if holder, held := pipelineLockHolder(ctx); !held || holder != lease.Token {
+		t.Fatalf("lock holder %d (held %v), want %d", holder, held, lease.Token)
+	}
+
+	if _, err := releaseFailedRunLock(ctx, functionFailedData{RunID: "run-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, held := pipelineLockHolder(ctx); held {
+		t.Error("lock of the failed run is still held")
+	}
+	if _, err := store.Get(ctx, pipelineRunPrefix+"run-1"); err == nil {
+		t.Error("run record left behind")
+	}
+}
+
+func TestReleaseFailedRunLockKeepsNewerLock(t *testing.T) {
+	store = newFailoverStore(nil)
+	ctx := context.Background()
+
+	// The failed run's lock expired and a newer run took it
+	lease, err := acquirePipelineLock(ctx)
+	if err != nil || !lease.Acquired {
+		t.Fatalf("acquire: %+v, %v", lease, err)
+	}
+	if err := store.Set(ctx, pipelineRunPrefix+"old-run", strconv.FormatInt(lease.Token-1, 10), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := releaseFailedRunLock(ctx, functionFailedData{RunID: "old-run"}); err != nil {
+		t.Fatal(err)
+	}
+	if holder, held := pipelineLockHolder(ctx); !held || holder != lease.Token {
+		t.Errorf("lock holder %d (held %v), want the newer run's %d", holder, held, lease.Token)
+	}
+}
@@ -3,19 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/inngest/inngestgo"
-	"github.com/inngest/inngestgo/step"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 )
@@ -25,10 +23,15 @@ var rdb *redis.Client
 
 // CryptoData represents a single cryptocurrency entry
 type CryptoData struct {
-	Name   string `json:"name"`
-	Symbol string `json:"symbol"`
-	Value  string `json:"value"`
-	Sort   string `json:"sort"`
+	ID       int      `json:"id,omitempty"` // LunarCrush coin ID; symbols aren't unique
+	Name     string   `json:"name"`
+	Symbol   string   `json:"symbol"`
+	Value    string   `json:"value"` // Display string, kept for backward compatibility
+	Sort     string   `json:"sort"`
+	RawValue *float64 `json:"raw_value"` // nil when LunarCrush didn't report the field
+	Rank     int      `json:"rank"`      // 1-based position in this metric's ranking
+	Unit     string   `json:"unit"`
+	Currency string   `json:"currency,omitempty"`
 }
 
 //  Single unified data structure for frontend
@@ -37,18 +40,26 @@ type CryptoDataResponse struct {
 	TotalMetrics int                          `json:"total_metrics"`
 	AllMetrics   map[string]MetricData        `json:"all_metrics"`
 	FetchStats   FetchStats                   `json:"fetch_stats"`
+	Generation   int64                        `json:"generation,omitempty"` // Fencing token of the run that stored it
 }
 
 type MetricData struct {
 	Name         string       `json:"name"`
 	Priority     string       `json:"priority"`
 	Description  string       `json:"description"`
+	Unit         string       `json:"unit"`
+	Currency     string       `json:"currency,omitempty"`
 	Success      bool         `json:"success"`
 	DataCount    int          `json:"data_count"`
-	AllData      []CryptoData `json:"all_data"`      // All 10 items
+	AllData      []CryptoData `json:"all_data"`      // All fetched items (per-metric limit)
 	Top3Preview  []CryptoData `json:"top_3_preview"` // Top 3 for quick display
 	FetchTimeMs  int64        `json:"fetch_time_ms"`
 	Error        string       `json:"error,omitempty"`
+	Changes      []RankChange `json:"changes,omitempty"`     // Movement since the previous run
+	ComparedTo   *time.Time   `json:"compared_to,omitempty"` // Timestamp of that previous run
+	UpdatedAt    *time.Time   `json:"updated_at,omitempty"`  // When AllData was fetched
+	Stale        bool         `json:"stale,omitempty"`       // Latest fetch failed (see Error); AllData is from UpdatedAt
+	StaleAgeSecs int64        `json:"stale_age_seconds,omitempty"`
 }
 
 type FetchStats struct {
@@ -83,42 +94,80 @@ type LunarCrushCoin struct {
 	// Working supply metrics
 	CirculatingSupply   *float64 `json:"circulating_supply,omitempty"`
 	MarketDominance     *float64 `json:"market_dominance,omitempty"`
+
+	// Every numeric field in the response keyed by its LunarCrush name, so the
+	// metric registry can use fields that have no typed counterpart above
+	Fields map[string]float64 `json:"fields,omitempty"`
 }
 
+// Units for raw metric values
+const (
+	UnitCurrency = "currency" // Amount in MetricConfig.Currency
+	UnitPercent  = "percent"
+	UnitRank     = "rank"
+	UnitCount    = "count"
+	UnitTokens   = "tokens"
+)
+
+// Display formatters for metric values
+const (
+	FormatUSDCompact = "usd_compact" // $1.2T
+	FormatUSD        = "usd"         // $1.23
+	FormatInteger    = "integer"     // 42
+	FormatPercent    = "percent"     // 3.45%
+	FormatCompact    = "compact"     // 1.2M
+	FormatSupply     = "supply"      // 19.7M, 1.0Qd
+	FormatDecimal    = "decimal"     // 0.12
+)
+
 type MetricConfig struct {
-	Name        string `json:"name"`
-	Priority    string `json:"priority"`
-	Description string `json:"description"`
+	Name        string `json:"name" yaml:"name"`
+	Field       string `json:"field" yaml:"field"` // LunarCrush field holding the value
+	Priority    string `json:"priority" yaml:"priority"`
+	Description string `json:"description" yaml:"description"`
+	Format      string `json:"format" yaml:"format"`
+	Unit        string `json:"unit" yaml:"unit"`
+	Currency    string `json:"currency,omitempty" yaml:"currency,omitempty"`
+	Limit       int    `json:"limit,omitempty" yaml:"limit,omitempty"` // Fetch depth; 0 means FETCH_LIMIT_DEFAULT
+	Disabled    bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
 }
 
-var AllSortableMetrics = map[string]MetricConfig{
+// Built-in registry, used when no METRICS_REGISTRY_FILE is present
+var defaultSortableMetrics = map[string]MetricConfig{
 	// HIGH PRIORITY METRICS (Core working metrics)
-	"market_cap":         {Name: "Market Cap", Priority: "high", Description: "Market Capitalization"},
-	"alt_rank":           {Name: "AltRank™", Priority: "high", Description: "Proprietary Performance Ranking"},
-	"price":              {Name: "Price", Priority: "high", Description: "Current USD Price"},
-	"volume_24h":         {Name: "24h Volume", Priority: "high", Description: "24 Hour Trading Volume"},
-	"interactions":       {Name: "Social Interactions", Priority: "high", Description: "Social Engagements"},
-	"percent_change_1h":  {Name: "1h Change", Priority: "high", Description: "1 Hour Price Change"},
-	"percent_change_24h": {Name: "24h Change", Priority: "high", Description: "24 Hour Price Change"},
-	"percent_change_7d":  {Name: "7d Change", Priority: "high", Description: "7 Day Price Change"},
+	"market_cap":         {Name: "Market Cap", Field: "market_cap", Priority: "high", Description: "Market Capitalization", Format: FormatUSDCompact, Unit: UnitCurrency, Currency: "USD", Limit: 100},
+	"alt_rank":           {Name: "AltRank™", Field: "alt_rank", Priority: "high", Description: "Proprietary Performance Ranking", Format: FormatInteger, Unit: UnitRank},
+	"price":              {Name: "Price", Field: "price", Priority: "high", Description: "Current USD Price", Format: FormatUSD, Unit: UnitCurrency, Currency: "USD"},
+	"volume_24h":         {Name: "24h Volume", Field: "volume_24h", Priority: "high", Description: "24 Hour Trading Volume", Format: FormatUSDCompact, Unit: UnitCurrency, Currency: "USD"},
+	"interactions":       {Name: "Social Interactions", Field: "interactions_24h", Priority: "high", Description: "Social Engagements", Format: FormatCompact, Unit: UnitCount},
+	"percent_change_1h":  {Name: "1h Change", Field: "percent_change_1h", Priority: "high", Description: "1 Hour Price Change", Format: FormatPercent, Unit: UnitPercent},
+	"percent_change_24h": {Name: "24h Change", Field: "percent_change_24h", Priority: "high", Description: "24 Hour Price Change", Format: FormatPercent, Unit: UnitPercent},
+	"percent_change_7d":  {Name: "7d Change", Field: "percent_change_7d", Priority: "high", Description: "7 Day Price Change", Format: FormatPercent, Unit: UnitPercent},
 
 	// MEDIUM PRIORITY METRICS (Working social & supply metrics)
-	"social_dominance":    {Name: "Social Dominance", Priority: "medium", Description: "Social Volume Percentage"},
-	"circulating_supply":  {Name: "Circulating Supply", Priority: "medium", Description: "Circulating Token Supply"},
-	"market_dominance":    {Name: "Market Dominance", Priority: "medium", Description: "Market Cap Percentage"},
+	"social_dominance":   {Name: "Social Dominance", Field: "social_dominance", Priority: "medium", Description: "Social Volume Percentage", Format: FormatPercent, Unit: UnitPercent},
+	"circulating_supply": {Name: "Circulating Supply", Field: "circulating_supply", Priority: "medium", Description: "Circulating Token Supply", Format: FormatSupply, Unit: UnitTokens},
+	"market_dominance":   {Name: "Market Dominance", Field: "market_dominance", Priority: "medium", Description: "Market Cap Percentage", Format: FormatPercent, Unit: UnitPercent},
 }
 
 // Helper functions
-func formatValue(value float64, sort string) string {
-	switch sort {
-	case "market_cap", "volume_24h":
+func formatValue(value float64, format string) string {
+	switch format {
+	case FormatUSDCompact:
 		return fmt.Sprintf("$%s", formatLargeNumber(int64(value)))
-	case "price":
+	case FormatUSD:
 		return fmt.Sprintf("$%.2f", value)
-	case "alt_rank":
+	case FormatInteger:
 		return fmt.Sprintf("%d", int(value))
-	case "percent_change_24h", "percent_change_1h", "percent_change_7d":
+	case FormatPercent:
 		return fmt.Sprintf("%.2f%%", value)
+	case FormatCompact:
+		return formatLargeNumber(int64(value))
+	case FormatSupply:
+		if value <= 0 {
+			return "0"
+		}
+		return formatSupplyNumber(value)
 	}
 	return fmt.Sprintf("%.2f", value)
 }
@@ -173,6 +222,33 @@ func formatSupplyNumber(n float64) string {
 	return fmt.Sprintf("%.0f", n)
 }
 
+// durationFromEnv reads a duration such as "15m" or "7d" from the environment
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := parseDurationWithDays(value)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️  Invalid %s=%q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// parseDurationWithDays extends time.ParseDuration with a "d" (day) suffix
+func parseDurationWithDays(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -180,119 +256,83 @@ func min(a, b int) int {
 	return b
 }
 
-func formatValueForMetric(coin LunarCrushCoin, sortType string) string {
-	switch sortType {
-	case "market_cap":
-		return formatValue(coin.MarketCap, sortType)
-	case "price":
-		return formatValue(coin.Price, sortType)
-	case "volume_24h":
-		return formatValue(coin.Volume24h, sortType)
-	case "percent_change_1h":
-		return formatValue(coin.PercentChange1h, sortType)
-	case "percent_change_24h":
-		return formatValue(coin.PercentChange24h, sortType)
-	case "percent_change_7d":
-		return formatValue(coin.PercentChange7d, sortType)
-	case "alt_rank":
-		return formatValue(float64(coin.AltRank), sortType)
-	case "interactions":
-		if coin.Interactions24h != nil {
-			return formatLargeNumber(int64(*coin.Interactions24h))
-		}
-		return "0"
-	case "social_dominance":
-		if coin.SocialDominance != nil {
-			return fmt.Sprintf("%.2f%%", *coin.SocialDominance)
-		}
-		return "0%"
-	case "circulating_supply":
-		if coin.CirculatingSupply != nil {
-			supply := *coin.CirculatingSupply
-			if supply <= 0 {
-				return "0"
-			}
-			return formatSupplyNumber(supply)
-		}
-		return "0"
-	case "market_dominance":
-		if coin.MarketDominance != nil {
-			return fmt.Sprintf("%.2f%%", *coin.MarketDominance)
+func formatValueForMetric(coin LunarCrushCoin, config MetricConfig) string {
+	value := rawValueForMetric(coin, config)
+	if value == nil {
+		if config.Format == FormatPercent {
+			return "0%"
 		}
-		return "0%"
-	default:
-		return formatValue(coin.Price, "price")
+		return formatValue(0, config.Format)
 	}
+	return formatValue(*value, config.Format)
+}
+
+// rawValueForMetric returns the unformatted value behind formatValueForMetric
+func rawValueForMetric(coin LunarCrushCoin, config MetricConfig) *float64 {
+	value, ok := coin.fieldValue(config.Field)
+	if !ok {
+		return nil
+	}
+	return &value
 }
 
 // Single function to fetch one metric
-func fetchSingleMetric(apiKey, sortType string, limit int) MetricData {
+func fetchSingleMetric(ctx context.Context, provider Provider, sortType string, limit int) MetricData {
+	result, _ := fetchMetricCoins(ctx, provider, sortType, limit)
+	return result
+}
+
+// fetchMetricCoins fetches one metric and also returns the coins behind it
+func fetchMetricCoins(ctx context.Context, provider Provider, sortType string, limit int) (MetricData, []LunarCrushCoin) {
 	startTime := time.Now()
 
-	config, exists := AllSortableMetrics[sortType]
+	config, exists := sortableMetrics()[sortType]
 	if !exists {
-		return MetricData{
-			Name:        sortType,
-			Priority:    "unknown",
-			Description: "Unknown metric",
-			Success:     false,
-			Error:       fmt.Sprintf("Unknown sort type: %s", sortType),
-		}
+		return unknownMetricData(sortType), nil
+	}
+
+	log.Printf("🌐 Fetching %s (%s) from %s", config.Name, config.Priority, provider.Name())
+
+	coins, err := provider.ListCoins(ctx, sortType, limit)
+	result := metricDataFromCoins(sortType, config, coins, err)
+	result.FetchTimeMs = time.Since(startTime).Milliseconds()
+
+	if result.Success {
+		log.Printf("✅ %s (%s) completed: %d items in %dms",
+			config.Name, config.Priority, result.DataCount, result.FetchTimeMs)
+	}
+	return result, coins
+}
+
+func unknownMetricData(sortType string) MetricData {
+	return MetricData{
+		Name:        sortType,
+		Priority:    "unknown",
+		Description: "Unknown metric",
+		Success:     false,
+		Error:       fmt.Sprintf("Unknown sort type: %s", sortType),
 	}
+}
 
+// Build a metric's ranking from coins already in rank order
+func metricDataFromCoins(sortType string, config MetricConfig, coins []LunarCrushCoin, err error) MetricData {
 	result := MetricData{
 		Name:        config.Name,
 		Priority:    config.Priority,
 		Description: config.Description,
+		Unit:        config.Unit,
+		Currency:    config.Currency,
 		Success:     false,
 		AllData:     []CryptoData{},
 		Top3Preview: []CryptoData{},
 	}
 
-	url := fmt.Sprintf("https://lunarcrush.com/api4/public/coins/list/v2?sort=%s&limit=%d", sortType, limit)
-	log.Printf("🌐 Fetching %s (%s): %s", config.Name, config.Priority, url)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		result.Error = fmt.Sprintf("Failed to create request: %v", err)
-		result.FetchTimeMs = time.Since(startTime).Milliseconds()
+		result.Error = err.Error()
 		return result
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		result.Error = fmt.Sprintf("Failed to fetch data: %v", err)
-		result.FetchTimeMs = time.Since(startTime).Milliseconds()
-		return result
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		result.Error = fmt.Sprintf("Failed to read response: %v", err)
-		result.FetchTimeMs = time.Since(startTime).Milliseconds()
-		return result
-	}
-
-	result.FetchTimeMs = time.Since(startTime).Milliseconds()
-
-	if resp.StatusCode != 200 {
-		result.Error = fmt.Sprintf("API returned status %d: %s", resp.StatusCode, string(body[:min(200, len(body))]))
-		return result
-	}
-
-	var response LunarCrushResponse
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		result.Error = fmt.Sprintf("Failed to parse JSON: %v", err)
-		return result
-	}
-
-	if len(response.Data) == 0 {
+	if len(coins) == 0 {
 		result.Error = "No data returned from API"
 		return result
 	}
@@ -301,14 +341,19 @@ func fetchSingleMetric(apiKey, sortType string, limit int) MetricData {
 	var allCryptoData []CryptoData
 	var top3Preview []CryptoData
 
-	for i, coin := range response.Data {
-		value := formatValueForMetric(coin, sortType)
+	for i, coin := range coins {
+		value := formatValueForMetric(coin, config)
 
 		crypto := CryptoData{
-			Name:   coin.Name,
-			Symbol: coin.Symbol,
-			Value:  value,
-			Sort:   sortType,
+			ID:       coin.ID,
+			Name:     coin.Name,
+			Symbol:   coin.Symbol,
+			Value:    value,
+			Sort:     sortType,
+			RawValue: rawValueForMetric(coin, config),
+			Rank:     i + 1,
+			Unit:     config.Unit,
+			Currency: config.Currency,
 		}
 
 		// Add to full data
@@ -320,18 +365,25 @@ func fetchSingleMetric(apiKey, sortType string, limit int) MetricData {
 		}
 	}
 
+	now := time.Now()
 	result.Success = true
-	result.DataCount = len(response.Data)
+	result.UpdatedAt = &now
+	result.DataCount = len(coins)
 	result.AllData = allCryptoData
 	result.Top3Preview = top3Preview
-
-	log.Printf("✅ %s (%s) completed: %d items in %dms",
-		config.Name, config.Priority, result.DataCount, result.FetchTimeMs)
 	return result
 }
 
 // Redis functions
+// Connect to Redis if enabled. Storage falls back to memory while Redis is
+// unreachable, at startup or later, and switches back once it answers again.
 func initRedis() {
+	if os.Getenv("REDIS_ENABLED") == "false" {
+		store = newFailoverStore(nil)
+		log.Printf("ℹ️  Redis disabled, using in-memory storage")
+		return
+	}
+
 	redisURL := os.Getenv("REDIS_URL")
 	if redisURL == "" {
 		redisURL = "redis://localhost:6379"
@@ -348,50 +400,61 @@ func initRedis() {
 		rdb = redis.NewClient(opt)
 	}
 
-	ctx := context.Background()
-	_, err = rdb.Ping(ctx).Result()
+	store = newFailoverStore(rdb)
+	readyRequiresRedis = os.Getenv("READY_REQUIRES_REDIS") != "false"
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisPingTimeout)
+	defer cancel()
+	start := time.Now()
+	err = rdb.Ping(ctx).Err()
+	redisHealth.recordPing(time.Since(start), err)
 	if err != nil {
-		log.Printf("⚠️  Redis connection failed: %v", err)
-		rdb = nil
+		log.Printf("⚠️  Redis connection failed, using in-memory storage until it is back: %v", err)
 	} else {
+		store.up.Store(true)
 		log.Printf("✅ Redis connected successfully")
 	}
-}
 
-//  Single function to store latest data
-func storeLatestDataInRedis(data CryptoDataResponse) {
-	if rdb == nil {
-		log.Printf("⚠️  Redis not available, skipping storage")
-		return
-	}
+	go monitorRedis(durationFromEnv("REDIS_HEALTH_INTERVAL", 10*time.Second))
+}
 
+//  Single function to store latest data. False when a newer generation is
+// already stored, in which case nothing is written or published.
+func storeLatestDataInRedis(data CryptoDataResponse) bool {
 	ctx := context.Background()
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("❌ Failed to marshal result: %v", err)
-		return
+		return false
 	}
 
-	// ALWAYS use the same key
+	// ALWAYS use the same key. It outlives freshness on purpose so a stalled
+	// refresh is served as stale data instead of disappearing.
 	key := "crypto:latest"
-	err = rdb.Set(ctx, key, jsonData, 15*time.Minute).Err()
+	stored, err := store.SetIfNewer(ctx, key, string(jsonData), data.Generation, snapshotRetention)
 	if err != nil {
-		log.Printf("❌ Failed to store in Redis: %v", err)
+		log.Printf("❌ Failed to store latest data: %v", err)
+	} else if !stored {
+		log.Printf("⚠️  Not storing generation %d: a newer run already stored its data", data.Generation)
+		return false
 	} else {
-		log.Printf("✅ Stored latest crypto data: %d successful, %d failed metrics",
-			data.FetchStats.SuccessfulFetches, data.FetchStats.FailedFetches)
+		log.Printf("✅ Stored latest crypto data in %s: %d successful, %d failed metrics",
+			store.Name(), data.FetchStats.SuccessfulFetches, data.FetchStats.FailedFetches)
 	}
+
+	// Keep a timestamped copy for history
+	storeSnapshotInRedis(data)
+
+	// Push to live stream clients on every instance
+	publishUpdate(data, jsonData)
+	return true
 }
 
-// Get latest data from Redis
+// Get latest data from Redis (or the in-memory fallback)
 func getLatestDataFromRedis() (CryptoDataResponse, bool) {
-	if rdb == nil {
-		return CryptoDataResponse{}, false
-	}
-
 	ctx := context.Background()
 	key := "crypto:latest"
-	data, err := rdb.Get(ctx, key).Result()
+	data, err := store.Get(ctx, key)
 	if err != nil {
 		return CryptoDataResponse{}, false
 	}
@@ -406,208 +469,33 @@ func getLatestDataFromRedis() (CryptoDataResponse, bool) {
 	return result, true
 }
 
-//  Single Inngest function that fetches all 11 working metrics
-func createUnifiedCryptoFunction(client inngestgo.Client, apiKey string) (inngestgo.ServableFunction, error) {
+// Scheduled refresh of every enabled metric
+func createUnifiedCryptoFunction(client inngestgo.Client, provider Provider) (inngestgo.ServableFunction, error) {
 	return inngestgo.CreateFunction(
 		client,
 		inngestgo.FunctionOpts{
 			ID: "fetch-all-crypto-metrics",
 		},
-		inngestgo.CronTrigger("*/5 * * * *"), // Every 5 minutes
+		inngestgo.CronTrigger(refreshSchedule.expr), // REFRESH_CRON, every 5 minutes by default
 		func(ctx context.Context, input inngestgo.Input[map[string]interface{}]) (any, error) {
-			log.Printf("🚀 Fetching ALL 11 working crypto metrics (cleaned function)")
-
-			startTime := time.Now()
-
-			// Get all metric names
-			allMetrics := []string{}
-			for sortType := range AllSortableMetrics {
-				allMetrics = append(allMetrics, sortType)
-			}
-
-			// Fetch all metrics in parallel
-			allResults, err := step.Run(ctx, "fetch-all-metrics", func(ctx context.Context) (CryptoDataResponse, error) {
-				var wg sync.WaitGroup
-				results := make(map[string]MetricData)
-				resultsMutex := &sync.Mutex{}
-
-				// Process in batches of 5 to avoid API rate limits
-				batchSize := 5
-				for i := 0; i < len(allMetrics); i += batchSize {
-					end := i + batchSize
-					if end > len(allMetrics) {
-						end = len(allMetrics)
-					}
-
-					batch := allMetrics[i:end]
-
-					for _, sortType := range batch {
-						wg.Add(1)
-						go func(st string) {
-							defer wg.Done()
-							result := fetchSingleMetric(apiKey, st, 10)
-
-							resultsMutex.Lock()
-							results[st] = result
-							resultsMutex.Unlock()
-						}(sortType)
-					}
-
-					wg.Wait()
-
-					// Small delay between batches
-					if end < len(allMetrics) {
-						time.Sleep(1 * time.Second)
-					}
-				}
-
-				// Count successes and failures
-				successful := 0
-				failed := 0
-				for _, result := range results {
-					if result.Success {
-						successful++
-					} else {
-						failed++
-					}
-				}
-
-				return CryptoDataResponse{
-					Timestamp:    time.Now(),
-					TotalMetrics: len(AllSortableMetrics),
-					AllMetrics:   results,
-					FetchStats: FetchStats{
-						TotalDurationMs:   time.Since(startTime).Milliseconds(),
-						SuccessfulFetches: successful,
-						FailedFetches:     failed,
-						LastUpdate:       time.Now().Format("2006-01-02 15:04:05"),
-					},
-				}, nil
-			})
-
-			if err != nil {
-				return nil, err
-			}
-
-			// Store in Redis
-			_, err = step.Run(ctx, "store-latest", func(ctx context.Context) (string, error) {
-				storeLatestDataInRedis(allResults)
-				return "stored", nil
-			})
-
-			if err != nil {
-				return nil, err
-			}
-
-			return map[string]interface{}{
-				"total_metrics":      len(allMetrics),
-				"successful_fetches": allResults.FetchStats.SuccessfulFetches,
-				"failed_fetches":     allResults.FetchStats.FailedFetches,
-				"total_duration_ms":  allResults.FetchStats.TotalDurationMs,
-				"status":            "completed",
-				"stored_in_redis":   "crypto:latest",
-			}, nil
+			return runPipeline(withPipelineRun(ctx, input.InputCtx.RunID), provider, PipelineOptions{Trigger: TriggerCron})
 		},
 	)
 }
 
-// MANUAL TRIGGER: For dev testing
-func createManualTriggerFunction(client inngestgo.Client, apiKey string) (inngestgo.ServableFunction, error) {
+// MANUAL TRIGGER: crypto/manual events, optionally for a subset of metrics
+func createManualTriggerFunction(client inngestgo.Client, provider Provider) (inngestgo.ServableFunction, error) {
 	return inngestgo.CreateFunction(
 		client,
 		inngestgo.FunctionOpts{
 			ID: "manual-crypto-trigger",
 		},
 		inngestgo.EventTrigger("crypto/manual", nil),
-		func(ctx context.Context, input inngestgo.Input[map[string]interface{}]) (any, error) {
+		func(ctx context.Context, input inngestgo.Input[PipelineOptions]) (any, error) {
+			opts := input.Event.Data
+			opts.Trigger = TriggerManual
 			log.Printf("🧪 MANUAL crypto fetch triggered")
-
-			startTime := time.Now()
-
-			// Get all metric names
-			allMetrics := []string{}
-			for sortType := range AllSortableMetrics {
-				allMetrics = append(allMetrics, sortType)
-			}
-
-			// Same logic as unified function
-			allResults, err := step.Run(ctx, "manual-fetch-all", func(ctx context.Context) (CryptoDataResponse, error) {
-				var wg sync.WaitGroup
-				results := make(map[string]MetricData)
-				resultsMutex := &sync.Mutex{}
-
-				batchSize := 5
-				for i := 0; i < len(allMetrics); i += batchSize {
-					end := i + batchSize
-					if end > len(allMetrics) {
-						end = len(allMetrics)
-					}
-
-					batch := allMetrics[i:end]
-
-					for _, sortType := range batch {
-						wg.Add(1)
-						go func(st string) {
-							defer wg.Done()
-							result := fetchSingleMetric(apiKey, st, 10)
-
-							resultsMutex.Lock()
-							results[st] = result
-							resultsMutex.Unlock()
-						}(sortType)
-					}
-
-					wg.Wait()
-
-					if end < len(allMetrics) {
-						time.Sleep(1 * time.Second)
-					}
-				}
-
-				successful := 0
-				failed := 0
-				for _, result := range results {
-					if result.Success {
-						successful++
-					} else {
-						failed++
-					}
-				}
-
-				return CryptoDataResponse{
-					Timestamp:    time.Now(),
-					TotalMetrics: len(AllSortableMetrics),
-					AllMetrics:   results,
-					FetchStats: FetchStats{
-						TotalDurationMs:   time.Since(startTime).Milliseconds(),
-						SuccessfulFetches: successful,
-						FailedFetches:     failed,
-						LastUpdate:       time.Now().Format("2006-01-02 15:04:05"),
-					},
-				}, nil
-			})
-
-			if err != nil {
-				return nil, err
-			}
-
-			_, err = step.Run(ctx, "manual-store", func(ctx context.Context) (string, error) {
-				storeLatestDataInRedis(allResults)
-				return "stored", nil
-			})
-
-			if err != nil {
-				return nil, err
-			}
-
-			return map[string]interface{}{
-				"trigger":            "manual",
-				"total_metrics":      len(allMetrics),
-				"successful_fetches": allResults.FetchStats.SuccessfulFetches,
-				"failed_fetches":     allResults.FetchStats.FailedFetches,
-				"total_duration_ms":  allResults.FetchStats.TotalDurationMs,
-				"status":            "completed",
-			}, nil
+			return runPipeline(withPipelineRun(ctx, input.InputCtx.RunID), provider, opts)
 		},
 	)
 }
@@ -617,56 +505,88 @@ func main() {
 		log.Printf("Warning: No .env file found: %v", err)
 	}
 
-	apiKey := os.Getenv("LUNARCRUSH_API_KEY")
-	if apiKey == "" {
-		log.Fatal("LUNARCRUSH_API_KEY environment variable is required")
+	provider, err := newProviderFromEnv()
+	if err != nil {
+		log.Fatal("Failed to create data provider: ", err)
 	}
 
-	log.Printf("✅ API Key loaded")
+	log.Printf("✅ Data provider loaded: %s", provider.Name())
 
+	loadMetricRegistry()
+	initFetchLimits()
+	initFetchMode()
+	initPipelineConfig()
+	initPipelineLockConfig()
+	initSchedulerConfig()
 	initRedis()
+	initSnapshotConfig()
+	initFreshnessConfig()
+	loadAlertRules()
+	initAdminAuth()
+	initAPIKeyConfig()
+	startUpdateSubscriber()
+
+	// Inngest client and functions; nil in standalone mode
+	var inngestClient inngestgo.Client
+	functionCount := 0
+	if schedulerMode == SchedulerInngest {
+		inngestClient, err = inngestgo.NewClient(inngestgo.ClientOpts{
+			AppID: "crypto-simple",
+		})
+		if err != nil {
+			log.Fatal("Failed to create Inngest client:", err)
+		}
 
-	// Create Inngest client
-	inngestClient, err := inngestgo.NewClient(inngestgo.ClientOpts{
-		AppID: "crypto-simple",
-	})
-	if err != nil {
-		log.Fatal("Failed to create Inngest client:", err)
-	}
+		// Create the SINGLE unified function
+		unifiedFunction, err := createUnifiedCryptoFunction(inngestClient, provider)
+		if err != nil {
+			log.Fatal("Failed to create unified function:", err)
+		}
 
-	// Create the SINGLE unified function
-	unifiedFunction, err := createUnifiedCryptoFunction(inngestClient, apiKey)
-	if err != nil {
-		log.Fatal("Failed to create unified function:", err)
-	}
+		// Create manual trigger for dev testing
+		manualFunction, err := createManualTriggerFunction(inngestClient, provider)
+		if err != nil {
+			log.Fatal("Failed to create manual function:", err)
+		}
 
-	// Create manual trigger for dev testing
-	manualFunction, err := createManualTriggerFunction(inngestClient, apiKey)
-	if err != nil {
-		log.Fatal("Failed to create manual function:", err)
-	}
+		// Webhook deliveries run as their own function so retries are durable
+		webhookFunction, err := createWebhookDeliveryFunction(inngestClient)
+		if err != nil {
+			log.Fatal("Failed to create webhook delivery function:", err)
+		}
+		// Releases the pipeline lock when either refresh function fails for good
+		lockFunction, err := createLockReleaseFunction(inngestClient, unifiedFunction, manualFunction)
+		if err != nil {
+			log.Fatal("Failed to create lock release function:", err)
+		}
+		functionCount = 4
 
-	log.Printf("✅ CLEANED Inngest functions created:")
-	log.Printf("   1. Unified function (every 5 min): %s", unifiedFunction.Name())
-	log.Printf("   2. Manual trigger (dev only): %s", manualFunction.Name())
+		log.Printf("✅ CLEANED Inngest functions created:")
+		log.Printf("   1. Unified function (%s): %s", refreshSchedule.expr, unifiedFunction.Name())
+		log.Printf("   2. Manual trigger (dev only): %s", manualFunction.Name())
+		log.Printf("   3. Webhook delivery: %s", webhookFunction.Name())
+		log.Printf("   4. Lock release on failure: %s", lockFunction.Name())
+	} else {
+		startStandaloneScheduler(provider)
+	}
 
 	// Initialize Gin
 	r := gin.Default()
 
+	// Client IPs (anonymous rate limits, audit log) only come from
+	// X-Forwarded-For when the request arrives through a trusted proxy
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	// Origin policy from CORS_PROFILE / CORS_ORIGINS (see corspolicy.go)
+	originPolicy := loadCORSPolicy()
+
 	r.Use(cors.New(cors.Config{
-		AllowOrigins: []string{
-			"http://localhost:3000",
-			"http://localhost:3001",
-			// Add your specific Vercel domain
-			"https://crypto-rankings-2vobnla22-danilobatsons-projects.vercel.app",
-			// Add the production domain (when you get a custom domain)
-			"https://crypto-rankings.vercel.app",
-			// Wildcard for Vercel preview deployments (optional)
-			"https://crypto-rankings-*.vercel.app",
-	},
+		AllowOriginFunc:  originPolicy.allows,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept"},
-		AllowCredentials: true,
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-API-Key"},
+		AllowCredentials: originPolicy.credentials,
 		MaxAge:           12 * time.Hour,
 	}))
 
@@ -676,43 +596,56 @@ func main() {
 			"service":       "crypto-simple-api",
 			"version":       "5.0.0",
 			"architecture":  "simplified",
-			"functions":     2,
-			"metrics":       len(AllSortableMetrics),
-			"update_freq":   "Every 5 minutes",
+			"provider":      provider.Name(),
+			"scheduler":     schedulerMode,
+			"functions":     functionCount,
+			"metrics":       len(sortableMetrics()),
+			"update_freq":   refreshSchedule.expr,
 			"redis_key":     "crypto:latest",
 			"removed":       "contributors_active, galaxy_score, posts_active, sentiment, topic_rank",
-			"working":       "11 stable metrics only",
+			"working":       fmt.Sprintf("%d stable metrics only", len(sortableMetrics())),
 		})
 	})
 
+	// Liveness: always 200 while the process is serving; "degraded" when
+	// Redis is configured but down
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "healthy",
-			"redis":  rdb != nil,
-		})
+		redisState := redisHealth.snapshot()
+		status := "healthy"
+		if redisState.Enabled && !redisState.Connected {
+			status = "degraded"
+		}
+
+		health := gin.H{
+			"status":         status,
+			"redis":          redisState,
+			"stream_clients": hub.clientCount(),
+		}
+		if reporter, ok := provider.(QuotaReporter); ok {
+			health["provider_quota"] = reporter.QuotaStatus()
+		}
+		c.JSON(200, health)
 	})
 
+	// Readiness: 503 while this instance shouldn't receive traffic
+	r.GET("/ready", serveReadiness)
+
 	// MAIN FRONTEND ENDPOINT: Single endpoint for all crypto data
-	r.GET("/api/crypto/data", func(c *gin.Context) {
-		data, exists := getLatestDataFromRedis()
-		if !exists {
-			c.JSON(404, gin.H{
-				"error": "No crypto data available yet",
-				"message": "Data is updated every 5 minutes",
-				"manual_trigger": "POST /dev/trigger",
-			})
-			return
-		}
+	r.GET("/api/crypto/data", requireAPIKey(), serveCryptoData)
 
-		c.JSON(200, data)
-	})
+	// Live updates over Server-Sent Events (mode=full or mode=diff)
+	r.GET("/api/crypto/stream", requireAPIKey(), streamCryptoData)
+
+	// Live updates over WebSocket with metric:<key> and symbol:<SYMBOL> topics
+	r.GET("/api/crypto/ws", requireAPIKey(), websocketHandler(originPolicy))
 
 	// Single metrics info endpoint
 	r.GET("/api/crypto/info", func(c *gin.Context) {
 		highPriority := []string{}
 		mediumPriority := []string{}
 
-		for k, v := range AllSortableMetrics {
+		metrics := sortableMetrics()
+		for k, v := range metrics {
 			if v.Priority == "high" {
 				highPriority = append(highPriority, k)
 			} else if v.Priority == "medium" {
@@ -721,55 +654,369 @@ func main() {
 		}
 
 		c.JSON(200, gin.H{
-			"metrics":         AllSortableMetrics,
-			"total":           len(AllSortableMetrics),
+			"metrics":         metrics,
+			"total":           len(metrics),
 			"high_priority":   highPriority,
 			"medium_priority": mediumPriority,
-			"update_schedule": "Every 5 minutes",
+			"update_schedule": refreshSchedule.describe(),
 			"data_endpoint":   "/api/crypto/data",
 			"structure": gin.H{
-				"all_data":     "Full 10 items per metric",
+				"all_data":     fmt.Sprintf("Top N items per metric (metric limit, default %d)", defaultFetchLimit),
 				"top_3_preview": "Quick preview per metric",
 				"fetch_stats":   "Success/failure counts and timing",
 			},
 			"removed_metrics": "contributors_active, galaxy_score, posts_active, sentiment, topic_rank",
-			"working_metrics": 11,
+			"working_metrics": len(metrics),
+			"registry":        metricRegistryInfo(),
+			"fetch_mode":      fetchMode,
 		})
 	})
 
-	// DEV ONLY: Manual trigger endpoint
-	r.POST("/dev/trigger", func(c *gin.Context) {
-		log.Printf("🧪 DEV: Manual crypto fetch triggered via API")
+	// Snapshot index: timestamps of stored runs within the retention window
+	r.GET("/api/crypto/snapshots", requireAPIKey(), func(c *gin.Context) {
+		now := time.Now()
+		from, err := parseTimeParam(c.DefaultQuery("from", snapshotRetention.String()), now)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := parseTimeParam(c.DefaultQuery("to", "now"), now)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
 
-		_, err := inngestClient.Send(context.Background(), map[string]interface{}{
-			"name": "crypto/manual",
-			"data": map[string]interface{}{
-				"manual": true,
-				"dev":    true,
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+		if err != nil || limit < 1 || limit > 5000 {
+			c.JSON(400, gin.H{"error": "Limit must be between 1 and 5000"})
+			return
+		}
+
+		snapshots, err := listSnapshots(from, to, limit)
+		if err != nil {
+			c.JSON(503, gin.H{"error": "Snapshot storage unavailable", "message": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"snapshots": snapshots,
+			"count":     len(snapshots),
+			"from":      from.UTC(),
+			"to":        to.UTC(),
+			"retention": snapshotRetention.String(),
+		})
+	})
+
+	// Full snapshot at or before a point in time (unix, RFC3339 or age like "1h")
+	r.GET("/api/crypto/snapshots/:at", requireAPIKey(), func(c *gin.Context) {
+		at, err := parseTimeParam(c.Param("at"), time.Now())
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		data, exists := getSnapshotAt(at)
+		if !exists {
+			c.JSON(404, gin.H{
+				"error":     "No snapshot found at or before the requested time",
+				"requested": at.UTC(),
+				"retention": snapshotRetention.String(),
+			})
+			return
+		}
+
+		c.JSON(200, data)
+	})
+
+	// Time series of one coin's value and rank for a metric across stored runs
+	r.GET("/api/crypto/history/:coin/:metric", requireAPIKey(), func(c *gin.Context) {
+		metric := c.Param("metric")
+		if _, exists := sortableMetrics()[metric]; !exists {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Unknown metric '%s'", metric)})
+			return
+		}
+
+		now := time.Now()
+		from, err := parseTimeParam(c.DefaultQuery("from", "24h"), now)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := parseTimeParam(c.DefaultQuery("to", "now"), now)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		var interval time.Duration
+		if v := c.Query("interval"); v != "" {
+			interval, err = parseDurationWithDays(v)
+			if err != nil || interval <= 0 {
+				c.JSON(400, gin.H{"error": "Interval must be a positive duration like 15m, 1h or 1d"})
+				return
+			}
+		}
+
+		id, symbol, err := resolveCoin(c.Param("coin"))
+		var ambiguous errAmbiguousSymbol
+		switch {
+		case errors.As(err, &ambiguous):
+			c.JSON(400, gin.H{"error": err.Error(), "ids": ambiguous.ids})
+			return
+		case err != nil:
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Unknown coin '%s'", c.Param("coin"))})
+			return
+		}
+
+		history, err := getCoinHistory(id, symbol, metric, from, to, interval)
+		if err != nil {
+			c.JSON(503, gin.H{"error": "Snapshot storage unavailable", "message": err.Error()})
+			return
+		}
+
+		c.JSON(200, history)
+	})
+
+	// Alert rules currently loaded
+	r.GET("/api/alerts/rules", requireAPIKey(), func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"rules": alertRules,
+			"total": len(alertRules),
+			"conditions": []string{
+				ConditionValueAbove, ConditionValueBelow,
+				ConditionEntersTop, ConditionLeavesTop,
+				ConditionRankUp, ConditionRankDown,
 			},
 		})
+	})
 
+	// Recently fired alerts, newest first
+	r.GET("/api/alerts/recent", requireAPIKey(), func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > alertRecentMax {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Limit must be between 1 and %d", alertRecentMax)})
+			return
+		}
+
+		alerts, err := getRecentAlerts(limit)
 		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to trigger manual function"})
+			c.JSON(503, gin.H{"error": "Alert storage unavailable", "message": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"alerts": alerts, "count": len(alerts)})
+	})
+
+	// Admin routes: API key required, every request is audited
+	admin := r.Group("/dev", requireAdmin())
+
+	// Manual trigger endpoint, at most once per TRIGGER_COOLDOWN per caller
+	// Optional JSON body: {"metrics": ["market_dominance"], "limit": 50, "dry_run": true}
+	admin.POST("/trigger", auditAdmin("trigger"), adminCooldown("trigger", triggerCooldown), func(c *gin.Context) {
+		log.Printf("🧪 DEV: Manual crypto fetch triggered via API by %s", adminCaller(c))
+
+		var opts PipelineOptions
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&opts); err != nil {
+				c.JSON(400, gin.H{"error": "Invalid request body", "message": err.Error()})
+				return
+			}
+		}
+		if err := opts.normalize(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(adminDetailKey, opts)
+		if generation, running := pipelineLockHolder(c.Request.Context()); running {
+			c.JSON(409, gin.H{"error": "A refresh is already running", "generation": generation})
 			return
 		}
 
+		if inngestClient == nil {
+			opts.Trigger = TriggerManual
+			go runPipelineDirect(provider, opts)
+		} else {
+			_, err := inngestClient.Send(context.Background(), inngestgo.Event{
+				Name: "crypto/manual",
+				Data: map[string]interface{}{
+					"metrics": opts.Metrics,
+					"limit":   opts.Limit,
+					"dry_run": opts.DryRun,
+				},
+			})
+
+			if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to trigger manual function"})
+				return
+			}
+		}
+
 		c.JSON(200, gin.H{
 			"message": "Manual crypto fetch triggered",
 			"status":  "processing",
 			"data_url": "/api/crypto/data",
 			"wait":    "~30 seconds for completion",
-			"metrics": "11 working metrics only",
+			"metrics": opts.Metrics,
+			"limit":   opts.Limit,
+			"dry_run": opts.DryRun,
+		})
+	})
+
+	// Recent admin requests, newest first. ?log=auth_failures lists failed
+	// authentication attempts instead.
+	admin.GET("/audit", auditAdmin("view-audit"), func(c *gin.Context) {
+		logName := c.DefaultQuery("log", "admin")
+		if logName != "admin" && logName != "auth_failures" {
+			c.JSON(400, gin.H{"error": "Log must be admin or auth_failures"})
+			return
+		}
+		key := adminAuditKey
+		if logName == "auth_failures" {
+			key = adminAuthFailuresKey
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > adminAuditMax {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Limit must be between 1 and %d", adminAuditMax)})
+			return
+		}
+
+		entries, err := getAdminAudit(key, limit)
+		if err != nil {
+			c.JSON(503, gin.H{"error": "Audit storage unavailable", "message": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"entries": entries, "count": len(entries)})
+	})
+
+	// Issue a partner API key; the key itself is only returned here
+	admin.POST("/apikeys", auditAdmin("issue-api-key"), func(c *gin.Context) {
+		var req APIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request body", "message": err.Error()})
+			return
+		}
+		if err := req.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, record, err := issueAPIKey(req, adminCaller(c))
+		if err != nil {
+			c.JSON(503, gin.H{"error": "API key storage unavailable", "message": err.Error()})
+			return
+		}
+		c.Set(adminDetailKey, record)
+
+		c.JSON(201, gin.H{"key": key, "api_key": record})
+	})
+
+	// Issued keys with usage counters
+	admin.GET("/apikeys", auditAdmin("list-api-keys"), func(c *gin.Context) {
+		keys, err := listAPIKeys()
+		if err != nil {
+			c.JSON(503, gin.H{"error": "API key storage unavailable", "message": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"api_keys": keys, "count": len(keys)})
+	})
+
+	admin.DELETE("/apikeys/:id", auditAdmin("revoke-api-key"), func(c *gin.Context) {
+		record, err := revokeAPIKey(c.Param("id"), adminCaller(c))
+		if errors.Is(err, errAPIKeyNotFound) {
+			c.JSON(404, gin.H{"error": "API key not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(503, gin.H{"error": "API key storage unavailable", "message": err.Error()})
+			return
+		}
+		c.Set(adminDetailKey, record)
+
+		c.JSON(200, gin.H{"revoked": record})
+	})
+
+	// Register a webhook endpoint; the signing secret is only returned here
+	admin.POST("/webhooks", auditAdmin("register-webhook"), func(c *gin.Context) {
+		var request Webhook
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid webhook body", "message": err.Error()})
+			return
+		}
+
+		webhook, err := registerWebhook(Webhook{URL: request.URL, Events: request.Events, Secret: request.Secret})
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Failed to register webhook", "message": err.Error()})
+			return
+		}
+		c.Set(adminDetailKey, gin.H{"id": webhook.ID, "url": webhook.URL, "events": webhook.Events})
+
+		c.JSON(201, gin.H{
+			"webhook":   webhook,
+			"signature": "X-Crypto-Signature: sha256=HMAC_SHA256(secret, X-Crypto-Timestamp + \".\" + body)",
 		})
 	})
 
+	admin.GET("/webhooks", auditAdmin("list-webhooks"), func(c *gin.Context) {
+		webhooks, err := listWebhooks()
+		if err != nil {
+			c.JSON(503, gin.H{"error": "Webhook storage unavailable", "message": err.Error()})
+			return
+		}
+
+		for i := range webhooks {
+			webhooks[i].Secret = ""
+		}
+		c.JSON(200, gin.H{"webhooks": webhooks, "total": len(webhooks), "events": allWebhookEvents})
+	})
+
+	admin.DELETE("/webhooks/:id", auditAdmin("delete-webhook"), func(c *gin.Context) {
+		removed, err := deleteWebhook(c.Param("id"))
+		if err != nil {
+			c.JSON(503, gin.H{"error": "Webhook storage unavailable", "message": err.Error()})
+			return
+		}
+		if !removed {
+			c.JSON(404, gin.H{"error": "Webhook not found"})
+			return
+		}
+		c.Set(adminDetailKey, gin.H{"id": c.Param("id")})
+
+		c.JSON(200, gin.H{"message": "Webhook deleted", "id": c.Param("id")})
+	})
+
+	// Delivery log for one webhook, newest first
+	admin.GET("/webhooks/:id/deliveries", auditAdmin("list-webhook-deliveries"), func(c *gin.Context) {
+		if _, exists := getWebhook(c.Param("id")); !exists {
+			c.JSON(404, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > webhookDeliveryLogMax {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Limit must be between 1 and %d", webhookDeliveryLogMax)})
+			return
+		}
+
+		deliveries, err := getWebhookDeliveries(c.Param("id"), limit)
+		if err != nil {
+			c.JSON(503, gin.H{"error": "Webhook storage unavailable", "message": err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{"deliveries": deliveries, "count": len(deliveries)})
+	})
+
 	// Backward compatibility endpoint (simplified)
-	r.GET("/list/cryptocurrencies/:sort/:limit", func(c *gin.Context) {
+	r.GET("/list/cryptocurrencies/:sort/:limit", requireAPIKey(), func(c *gin.Context) {
 		sort := c.Param("sort")
 		limitStr := c.Param("limit")
 
-		validSorts := make([]string, 0, len(AllSortableMetrics))
-		for sortType := range AllSortableMetrics {
+		metrics := sortableMetrics()
+		validSorts := make([]string, 0, len(metrics))
+		for sortType := range metrics {
 			validSorts = append(validSorts, sortType)
 		}
 
@@ -791,48 +1038,58 @@ func main() {
 		}
 
 		limit, err := strconv.Atoi(limitStr)
-		if err != nil || limit < 1 || limit > 100 {
-			c.JSON(400, gin.H{"error": "Limit must be between 1 and 100"})
+		if err != nil || limit < 1 || limit > onDemandMaxLimit {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Limit must be between 1 and %d", onDemandMaxLimit)})
 			return
 		}
 
-		// Get data from Redis
+		// Serve from the stored run when it's deep enough
 		data, exists := getLatestDataFromRedis()
-		if !exists {
-			c.JSON(404, gin.H{
-				"error": "No data available",
-				"suggestion": "Use /api/crypto/data",
-			})
-			return
-		}
-
-		// Return specific metric data
-		if metricData, exists := data.AllMetrics[sort]; exists {
-			// Limit the results
-			limitedData := metricData.AllData
-			if limit < len(limitedData) {
-				limitedData = limitedData[:limit]
-			}
-
+		if metricData, ok := data.AllMetrics[sort]; exists && ok && metricData.Success && limit <= len(metricData.AllData) {
 			c.JSON(200, gin.H{
 				"message":   "Crypto data from unified API",
 				"sort":      sort,
 				"limit":     limit,
-				"data":      limitedData,
-				"count":     len(limitedData),
+				"data":      metricData.AllData[:limit],
+				"count":     limit,
 				"timestamp": data.Timestamp,
 				"source":    "unified-api",
 				"status":    "completed",
 			})
-		} else {
-			c.JSON(404, gin.H{
-				"error": fmt.Sprintf("Metric '%s' not found", sort),
+			return
+		}
+
+		// Cache is missing or too shallow: fetch this metric on demand
+		metricData, fetchedAt := fetchMetricOnDemand(c.Request.Context(), provider, sort)
+		if !metricData.Success {
+			c.JSON(502, gin.H{
+				"error":      fmt.Sprintf("Failed to fetch metric '%s'", sort),
+				"message":    metricData.Error,
 				"suggestion": "Use /api/crypto/data for all metrics",
 			})
+			return
+		}
+
+		limitedData := metricData.AllData
+		if limit < len(limitedData) {
+			limitedData = limitedData[:limit]
 		}
+
+		c.JSON(200, gin.H{
+			"message":   "Crypto data fetched on demand",
+			"sort":      sort,
+			"limit":     limit,
+			"data":      limitedData,
+			"count":     len(limitedData),
+			"timestamp": fetchedAt,
+			"source":    "on-demand",
+			"status":    "completed",
+		})
 	})
 
-	r.Any("/api/inngest", gin.WrapH(inngestClient.Serve()))
+	if inngestClient != nil {
+		r.Any("/api/inngest", gin.WrapH(inngestClient.Serve()))
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
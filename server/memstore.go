@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// At most this many plain keys are kept in memory; the ones closest to
+// expiring are evicted first. Snapshots would otherwise pile up for days.
+const memoryStoreMaxKeys = 1000
+
+type memoryValue struct {
+	value   string
+	expires time.Time // Zero means no expiry
+}
+
+func (v memoryValue) expired(now time.Time) bool {
+	return !v.expires.IsZero() && !now.Before(v.expires)
+}
+
+// memoryStore is an in-process Store used while Redis is unavailable. It is
+// local to this instance and lost on restart.
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string]memoryValue
+	zsets  map[string]map[string]float64
+	lists  map[string][]string
+	hashes map[string]map[string]string
+
+	listCaps map[string]int // Length each list is trimmed to, so the flush trims Redis the same way
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		values: map[string]memoryValue{},
+		zsets:  map[string]map[string]float64{},
+		lists:  map[string][]string{},
+		hashes: map[string]map[string]string{},
+
+		listCaps: map[string]int{},
+	}
+}
+
+func (m *memoryStore) Name() string {
+	return "memory"
+}
+
+// Caller holds the lock
+func (m *memoryStore) lookup(key string) (memoryValue, bool) {
+	v, ok := m.values[key]
+	if ok && v.expired(time.Now()) {
+		delete(m.values, key)
+		return memoryValue{}, false
+	}
+	return v, ok
+}
+
+// Caller holds the lock
+func (m *memoryStore) set(key, value string, ttl time.Duration) {
+	v := memoryValue{value: value}
+	if ttl > 0 {
+		v.expires = time.Now().Add(ttl)
+	}
+	m.values[key] = v
+	if len(m.values) > memoryStoreMaxKeys {
+		m.evict()
+	}
+}
+
+// Drop expired keys, then the soonest-expiring ones until under the cap
+func (m *memoryStore) evict() {
+	now := time.Now()
+	expiring := make([]string, 0, len(m.values))
+	for key, v := range m.values {
+		if v.expired(now) {
+			delete(m.values, key)
+		} else if !v.expires.IsZero() {
+			expiring = append(expiring, key)
+		}
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		return m.values[expiring[i]].expires.Before(m.values[expiring[j]].expires)
+	})
+	for _, key := range expiring {
+		if len(m.values) <= memoryStoreMaxKeys {
+			break
+		}
+		delete(m.values, key)
+	}
+}
+
+func (m *memoryStore) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.lookup(key)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v.value, nil
+}
+
+func (m *memoryStore) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		if v, ok := m.lookup(key); ok {
+			values[i] = v.value
+		}
+	}
+	return values, nil
+}
+
+func (m *memoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, value, ttl)
+	return nil
+}
+
+func (m *memoryStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.lookup(key); exists {
+		return false, nil
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+func (m *memoryStore) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.values, key)
+		delete(m.zsets, key)
+		delete(m.lists, key)
+		delete(m.listCaps, key)
+		delete(m.hashes, key)
+	}
+	return nil
+}
+
+func (m *memoryStore) IncrFrom(ctx context.Context, key, floorKey string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, k := range []string{key, floorKey} {
+		v, ok := m.lookup(k)
+		if !ok {
+			continue
+		}
+		current, err := strconv.ParseInt(v.value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s is not an integer", k)
+		}
+		n = max(n, current)
+	}
+	n++
+	m.values[key] = memoryValue{value: strconv.FormatInt(n, 10)} // Counters never expire
+	return n, nil
+}
+
+// Raise a counter to at least n, so IncrFrom carries on from a count kept elsewhere
+func (m *memoryStore) raiseCounter(key string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.lookup(key); ok {
+		if current, err := strconv.ParseInt(v.value, 10, 64); err == nil && current >= n {
+			return
+		}
+	}
+	m.values[key] = memoryValue{value: strconv.FormatInt(n, 10)}
+}
+
+func (m *memoryStore) CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.lookup(key); !ok || v.value != value {
+		return false, nil
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+func (m *memoryStore) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.lookup(key); !ok || v.value != value {
+		return false, nil
+	}
+	delete(m.values, key)
+	return true, nil
+}
+
+func (m *memoryStore) SetIfNewer(ctx context.Context, key, value string, generation int64, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.lookup(generationKey(key)); ok {
+		if current, _ := strconv.ParseInt(v.value, 10, 64); generation < current {
+			return false, nil
+		}
+	}
+	m.set(key, value, ttl)
+	m.set(generationKey(key), strconv.FormatInt(generation, 10), ttl)
+	return true, nil
+}
+
+func (m *memoryStore) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.zsets[key] == nil {
+		m.zsets[key] = map[string]float64{}
+	}
+	m.zsets[key][member] = score
+	return nil
+}
+
+func (m *memoryStore) ZRangeByScore(ctx context.Context, key string, min, max float64, limit int, rev bool) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	zset := m.zsets[key]
+	members := make([]string, 0, len(zset))
+	for member, score := range zset {
+		if score >= min && score <= max {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := zset[members[i]], zset[members[j]]
+		if a == b {
+			return (members[i] < members[j]) != rev
+		}
+		return (a < b) != rev
+	})
+	if limit > 0 && limit < len(members) {
+		members = members[:limit]
+	}
+	return members, nil
+}
+
+func (m *memoryStore) ZRemRangeByScore(ctx context.Context, key string, min, max float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for member, score := range m.zsets[key] {
+		if score >= min && score <= max {
+			delete(m.zsets[key], member)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) LPushTrim(ctx context.Context, key string, maxLen int, values ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]string, 0, len(values)+len(m.lists[key]))
+	for i := len(values) - 1; i >= 0; i-- {
+		list = append(list, values[i]) // LPUSH puts the last value first
+	}
+	list = append(list, m.lists[key]...)
+	if maxLen > 0 && len(list) > maxLen {
+		list = list[:maxLen]
+	}
+	m.lists[key] = list
+	m.listCaps[key] = maxLen
+	return nil
+}
+
+func (m *memoryStore) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := m.lists[key]
+	if stop < 0 || stop >= len(list) {
+		stop = len(list) - 1
+	}
+	if start >= len(list) || start > stop {
+		return []string{}, nil
+	}
+	return append([]string(nil), list[start:stop+1]...), nil
+}
+
+func (m *memoryStore) HSet(ctx context.Context, key, field, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hashes[key] == nil {
+		m.hashes[key] = map[string]string{}
+	}
+	m.hashes[key][field] = value
+	return nil
+}
+
+func (m *memoryStore) HGet(ctx context.Context, key, field string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.hashes[key][field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *memoryStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fields := make(map[string]string, len(m.hashes[key]))
+	for field, value := range m.hashes[key] {
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+func (m *memoryStore) HDel(ctx context.Context, key, field string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.hashes[key][field]
+	delete(m.hashes[key], field)
+	return ok, nil
+}
+
+func (m *memoryStore) HIncrBy(ctx context.Context, key, field string, n int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hashes[key] == nil {
+		m.hashes[key] = map[string]string{}
+	}
+	var current int64
+	if value, ok := m.hashes[key][field]; ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s %s is not an integer", key, field)
+		}
+		current = parsed
+	}
+	current += n
+	m.hashes[key][field] = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+func (m *memoryStore) SlidingWindowAllow(ctx context.Context, key string, limit int, window time.Duration) (WindowResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	hits := m.zsets[key]
+	if hits == nil {
+		hits = map[string]float64{}
+		m.zsets[key] = hits
+	}
+	oldest := math.Inf(1)
+	for member, score := range hits {
+		if score <= float64(now-window.Milliseconds()) {
+			delete(hits, member)
+		} else if score < oldest {
+			oldest = score
+		}
+	}
+	if len(hits) >= limit {
+		return WindowResult{
+			Count:      len(hits),
+			RetryAfter: time.Duration(int64(oldest)+window.Milliseconds()-now) * time.Millisecond,
+		}, nil
+	}
+	hits[strconv.FormatInt(now, 10)+"-"+randomHex(4)] = float64(now)
+	return WindowResult{Allowed: true, Count: len(hits)}, nil
+}
+
+// Coordination keys that only mean something in the store they were taken
+// in. Copying them would overwrite a lock, fence or lease held in Redis.
+var memoryLocalKeys = map[string]bool{
+	pipelineLockKey:    true,
+	pipelineFenceKey:   true,
+	schedulerLeaderKey: true,
+}
+
+// Rate-limit windows are per store too. Redis keeps counting its own hits,
+// and merging the outage's hits in would block callers twice over.
+var memoryLocalPrefixes = []string{apiKeyRatePrefix, anonRatePrefix, adminAuthFailurePrefix}
+
+// Hashes of counters: numeric fields are added to Redis's counts instead of
+// replacing them. Other fields (last_used) are set.
+var memoryCounterPrefixes = []string{apiKeyUsagePrefix}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy everything into another store and clear this one. Plain keys keep
+// their remaining TTL; list entries are pushed in front of what's there and
+// the list is trimmed to the length its writers asked for.
+// Values written with SetIfNewer are copied the same way, so they never
+// replace data of a higher generation.
+func (m *memoryStore) flushTo(ctx context.Context, dst Store) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	copied := 0
+	for key, v := range m.values {
+		if v.expired(now) || memoryLocalKeys[key] {
+			continue
+		}
+		if base, ok := strings.CutSuffix(key, ":generation"); ok {
+			if _, fenced := m.values[base]; fenced {
+				continue // Copied by SetIfNewer along with its value
+			}
+		}
+		var ttl time.Duration
+		if !v.expires.IsZero() {
+			ttl = v.expires.Sub(now)
+		}
+		if g, ok := m.lookup(generationKey(key)); ok {
+			generation, _ := strconv.ParseInt(g.value, 10, 64)
+			if _, err := dst.SetIfNewer(ctx, key, v.value, generation, ttl); err != nil {
+				return copied, err
+			}
+		} else if err := dst.Set(ctx, key, v.value, ttl); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	for key, zset := range m.zsets {
+		if hasAnyPrefix(key, memoryLocalPrefixes) {
+			continue
+		}
+		for member, score := range zset {
+			if err := dst.ZAdd(ctx, key, score, member); err != nil {
+				return copied, err
+			}
+		}
+		copied++
+	}
+	for key, list := range m.lists {
+		if len(list) == 0 {
+			continue
+		}
+		reversed := make([]string, len(list))
+		for i, value := range list {
+			reversed[len(list)-1-i] = value
+		}
+		if err := dst.LPushTrim(ctx, key, m.listCaps[key], reversed...); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	for key, fields := range m.hashes {
+		counters := hasAnyPrefix(key, memoryCounterPrefixes)
+		for field, value := range fields {
+			if n, err := strconv.ParseInt(value, 10, 64); counters && err == nil {
+				if _, err := dst.HIncrBy(ctx, key, field, n); err != nil {
+					return copied, err
+				}
+			} else if err := dst.HSet(ctx, key, field, value); err != nil {
+				return copied, err
+			}
+		}
+		copied++
+	}
+
+	m.values = map[string]memoryValue{}
+	m.zsets = map[string]map[string]float64{}
+	m.lists = map[string][]string{}
+	m.hashes = map[string]map[string]string{}
+	m.listCaps = map[string]int{}
+	return copied, nil
+}
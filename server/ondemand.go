@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// On-demand fetches serve legacy requests deeper than the stored run. Each
+// metric is fetched once at the endpoint's maximum depth and cached briefly,
+// so any limit is a slice of the same cached result rather than its own API call.
+const (
+	onDemandKeyPrefix = "crypto:ondemand:"
+	onDemandMaxLimit  = 100 // Deepest /list/cryptocurrencies/:sort/:limit request
+)
+
+var onDemandTTL = 5 * time.Minute // ON_DEMAND_TTL
+
+const (
+	onDemandFailureTTL = 30 * time.Second // How long a failed fetch is served before retrying
+	onDemandTimeout    = time.Minute
+)
+
+// Depth used when a metric doesn't set its own limit (FETCH_LIMIT_DEFAULT)
+var defaultFetchLimit = 25
+
+const maxFetchLimit = 1000
+
+type onDemandResult struct {
+	Timestamp time.Time  `json:"timestamp"`
+	Metric    MetricData `json:"metric"`
+}
+
+func initFetchLimits() {
+	if value := os.Getenv("FETCH_LIMIT_DEFAULT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxFetchLimit {
+			log.Printf("⚠️  Invalid FETCH_LIMIT_DEFAULT=%q, using %d", value, defaultFetchLimit)
+		} else {
+			defaultFetchLimit = limit
+		}
+	}
+	onDemandTTL = durationFromEnv("ON_DEMAND_TTL", onDemandTTL)
+	log.Printf("✅ Default fetch depth: top %d per metric, on-demand fetches cached for %s", defaultFetchLimit, onDemandTTL)
+}
+
+// How many coins to fetch for a metric on each run
+func fetchLimitFor(config MetricConfig) int {
+	if config.Limit > 0 {
+		return config.Limit
+	}
+	return defaultFetchLimit
+}
+
+// Concurrent cold requests for the same metric share one fetch
+var onDemandGroup singleflight.Group
+
+func fetchMetricOnDemand(ctx context.Context, provider Provider, sortType string) (MetricData, time.Time) {
+	key := onDemandKeyPrefix + sortType
+
+	if cached, ok := cachedOnDemand(ctx, key); ok {
+		return cached.Metric, cached.Timestamp
+	}
+
+	fetched := onDemandGroup.DoChan(key, func() (interface{}, error) {
+		// Another caller may have filled the cache while this one waited
+		if cached, ok := cachedOnDemand(ctx, key); ok {
+			return cached, nil
+		}
+
+		// Detached from the first caller, whose request may end before the others
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), onDemandTimeout)
+		defer cancel()
+
+		log.Printf("🌐 On-demand fetch for %s (top %d)", sortType, onDemandMaxLimit)
+		result := onDemandResult{Timestamp: time.Now(), Metric: fetchSingleMetric(fetchCtx, provider, sortType, onDemandMaxLimit)}
+
+		// Failures are cached too, briefly, so retries can't drain the
+		// provider quota the scheduled runs need
+		ttl := onDemandTTL
+		if !result.Metric.Success {
+			ttl = onDemandFailureTTL
+		}
+		if raw, err := json.Marshal(result); err == nil {
+			if err := store.Set(fetchCtx, key, string(raw), ttl); err != nil {
+				log.Printf("❌ Failed to cache on-demand result: %v", err)
+			}
+		}
+		return result, nil
+	})
+
+	select {
+	case shared := <-fetched:
+		result := shared.Val.(onDemandResult)
+		return result.Metric, result.Timestamp
+	case <-ctx.Done():
+		return MetricData{Error: ctx.Err().Error()}, time.Now()
+	}
+}
+
+func cachedOnDemand(ctx context.Context, key string) (onDemandResult, bool) {
+	raw, err := store.Get(ctx, key)
+	if err != nil {
+		return onDemandResult{}, false
+	}
+	var cached onDemandResult
+	if err := json.Unmarshal([]byte(raw), &cached); err != nil {
+		return onDemandResult{}, false
+	}
+	return cached, true
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingProvider blocks each call until release is closed and counts calls
+type countingProvider struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (p *countingProvider) Name() string { return "counting" }
+
+func (p *countingProvider) ListCoins(ctx context.Context, sort string, limit int) ([]LunarCrushCoin, error) {
+	p.calls.Add(1)
+	<-p.release
+	if p.err != nil {
+		return nil, p.err
+	}
+	return []LunarCrushCoin{{ID: 1, Symbol: "BTC", Name: "Bitcoin", Price: 100}}, nil
+}
+
+func TestOnDemandSharesConcurrentFetches(t *testing.T) {
+	store = newFailoverStore(nil)
+	provider := &countingProvider{release: make(chan struct{})}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if metricData, _ := fetchMetricOnDemand(context.Background(), provider, "price"); !metricData.Success {
+				t.Errorf("on-demand fetch failed: %s", metricData.Error)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond) // Let every caller join the fetch
+	close(provider.release)
+	wg.Wait()
+
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("%d upstream calls, want 1", calls)
+	}
+}
+
+func TestOnDemandCachesFailures(t *testing.T) {
+	store = newFailoverStore(nil)
+	provider := &countingProvider{release: make(chan struct{}), err: errors.New("upstream down")}
+	close(provider.release)
+
+	for i := 0; i < 3; i++ {
+		if metricData, _ := fetchMetricOnDemand(context.Background(), provider, "price"); metricData.Success {
+			t.Fatal("failed fetch reported success")
+		}
+	}
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("%d upstream calls, want 1 while the failure is cached", calls)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	inngesterrors "github.com/inngest/inngestgo/errors"
+	"github.com/inngest/inngestgo/group"
+	"github.com/inngest/inngestgo/step"
+)
+
+const (
+	TriggerCron   = "cron"
+	TriggerManual = "manual"
+)
+
+// How long a failing metric keeps serving its last good data (STALE_DATA_MAX_AGE)
+var staleDataMaxAge = 24 * time.Hour
+
+func initPipelineConfig() {
+	staleDataMaxAge = durationFromEnv("STALE_DATA_MAX_AGE", staleDataMaxAge)
+}
+
+type directExecutionKey struct{}
+
+// Mark ctx as running outside Inngest (the standalone scheduler)
+func withDirectExecution(ctx context.Context) context.Context {
+	return context.WithValue(ctx, directExecutionKey{}, true)
+}
+
+func isDirectExecution(ctx context.Context) bool {
+	direct, _ := ctx.Value(directExecutionKey{}).(bool)
+	return direct
+}
+
+// runStep is step.Run under Inngest and a plain call otherwise
+func runStep[T any](ctx context.Context, id string, fn func(ctx context.Context) (T, error)) (T, error) {
+	if isDirectExecution(ctx) {
+		return fn(ctx)
+	}
+	return step.Run(ctx, id, fn)
+}
+
+// PipelineOptions selects what a run refreshes. It is also the data of the
+// crypto/manual event, so /dev/trigger can refresh a single broken metric.
+type PipelineOptions struct {
+	Trigger string   `json:"trigger,omitempty"`
+	Metrics []string `json:"metrics,omitempty"` // Subset to refresh; empty means every enabled metric
+	Limit   int      `json:"limit,omitempty"`   // Overrides each metric's fetch depth (see fetchLimit)
+	DryRun  bool     `json:"dry_run,omitempty"` // Fetch and compare, but don't store, alert or notify
+}
+
+// PipelineResult is what both Inngest functions return
+type PipelineResult struct {
+	Trigger           string   `json:"trigger"`
+	Metrics           []string `json:"metrics"`
+	TotalMetrics      int      `json:"total_metrics"`
+	SuccessfulFetches int      `json:"successful_fetches"`
+	FailedFetches     int      `json:"failed_fetches"`
+	TotalDurationMs   int64    `json:"total_duration_ms"`
+	Generation        int64    `json:"generation,omitempty"`
+	Status            string   `json:"status"` // completed, dry_run, skipped (another run holds the lock) or superseded
+	DryRun            bool     `json:"dry_run,omitempty"`
+	StoredInRedis     string   `json:"stored_in_redis,omitempty"`
+	AlertsFired       int      `json:"alerts_fired"`
+	WebhooksQueued    int      `json:"webhooks_queued"`
+}
+
+// Check the options against the registry and fill in the metric list
+func (o *PipelineOptions) normalize() error {
+	registry := sortableMetrics()
+	if len(o.Metrics) == 0 {
+		for sortType := range registry {
+			o.Metrics = append(o.Metrics, sortType)
+		}
+	}
+	for _, sortType := range o.Metrics {
+		if _, exists := registry[sortType]; !exists {
+			return fmt.Errorf("unknown metric %q", sortType)
+		}
+	}
+	if o.Limit < 0 || o.Limit > maxFetchLimit {
+		return fmt.Errorf("limit must be between 1 and %d (or 0 for the metric default)", maxFetchLimit)
+	}
+	sort.Strings(o.Metrics)
+	return nil
+}
+
+// Fetch depth for one metric. Outside dry runs, the limit override can make a
+// stored run deeper but never shallower than the metric's own limit: a
+// shallower ranking would hide the coins below it from the legacy route and
+// from later rank comparisons.
+func (o PipelineOptions) fetchLimit(config MetricConfig) int {
+	limit := fetchLimitFor(config)
+	switch {
+	case o.Limit == 0:
+		return limit
+	case o.DryRun:
+		return o.Limit
+	}
+	return max(o.Limit, limit)
+}
+
+// runPipeline fetches the selected metrics, merges them into the latest run,
+// stores the result and notifies alert rules and webhooks. Under Inngest each
+// metric and each later stage is a step, so a retry resumes where the
+// previous attempt failed instead of refetching everything. A run that finds
+// another one holding the pipeline lock is skipped rather than queued.
+func runPipeline(ctx context.Context, provider Provider, opts PipelineOptions) (PipelineResult, error) {
+	if err := opts.normalize(); err != nil {
+		return PipelineResult{}, err
+	}
+
+	lease, err := runStep(ctx, "acquire-lock", func(ctx context.Context) (PipelineLease, error) {
+		return acquirePipelineLock(ctx)
+	})
+	if err != nil {
+		return PipelineResult{}, err
+	}
+	if !lease.Acquired {
+		log.Printf("⏭️  Pipeline (%s) skipped: generation %d is still running", opts.Trigger, lease.HeldBy)
+		return PipelineResult{Trigger: opts.Trigger, Metrics: opts.Metrics, TotalMetrics: len(opts.Metrics), Status: "skipped"}, nil
+	}
+	if isDirectExecution(ctx) {
+		lockCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go keepPipelineLock(lockCtx, lease.Token)
+		defer releasePipelineLock(context.Background(), lease.Token) // Also covers error returns
+	}
+	release := func() error {
+		_, err := runStep(ctx, "release-lock", func(ctx context.Context) (bool, error) {
+			releasePipelineLock(ctx, lease.Token)
+			return true, nil
+		})
+		return err
+	}
+
+	log.Printf("🚀 Pipeline (%s, generation %d): fetching %d metrics (dry run: %v)", opts.Trigger, lease.Token, len(opts.Metrics), opts.DryRun)
+
+	results, coins, err := fetchMetricSteps(ctx, provider, opts)
+	if err != nil {
+		return PipelineResult{}, err
+	}
+
+	// Merge the per-metric results into one run and compare it against the
+	// previous run before it gets overwritten
+	allResults, err := runStep(ctx, "merge-results", func(ctx context.Context) (CryptoDataResponse, error) {
+		// Wall-clock time from taking the lock, just before fetching, to now
+		data := mergeWithPrevious(mergeMetricResults(results, time.Since(lease.AcquiredAt)))
+		data.Generation = lease.Token
+		return data, nil
+	})
+	if err != nil {
+		return PipelineResult{}, err
+	}
+
+	result := PipelineResult{
+		Trigger:           opts.Trigger,
+		Metrics:           opts.Metrics,
+		TotalMetrics:      len(opts.Metrics),
+		SuccessfulFetches: allResults.FetchStats.SuccessfulFetches,
+		FailedFetches:     allResults.FetchStats.FailedFetches,
+		TotalDurationMs:   allResults.FetchStats.TotalDurationMs,
+		Generation:        lease.Token,
+		Status:            "completed",
+		DryRun:            opts.DryRun,
+	}
+	if opts.DryRun {
+		result.Status = "dry_run"
+		return result, release()
+	}
+
+	stored, err := runStep(ctx, "store-latest", func(ctx context.Context) (bool, error) {
+		return storeLatestDataInRedis(allResults), nil
+	})
+	if err != nil {
+		return PipelineResult{}, err
+	}
+	if !stored {
+		// A newer run already stored its data; alerts and webhooks for this one would be out of date
+		result.Status = "superseded"
+		return result, release()
+	}
+	result.StoredInRedis = "crypto:latest"
+
+	// Check alert rules against the new run
+	alerts, err := runStep(ctx, "evaluate-alerts", func(ctx context.Context) ([]Alert, error) {
+		return processAlerts(allResults, coins), nil
+	})
+	if err != nil {
+		return PipelineResult{}, err
+	}
+	result.AlertsFired = len(alerts)
+
+	// Tell registered webhooks about the refresh, failures and alerts
+	result.WebhooksQueued, err = queueWebhookJobs(ctx, allResults, alerts)
+	if err != nil {
+		return PipelineResult{}, err
+	}
+
+	return result, release()
+}
+
+// Fetch each metric in its own step. A failed fetch errors the step so
+// Inngest retries just that metric; once its retries are exhausted the failed
+// MetricData is kept and the run carries on with the rest. The provider
+// doesn't retry inside a step, so each step attempt is one request per page. In universe mode
+// there is a single fetch, so there is a single step. The fetched coins come
+// back too, cut down to what the alert rules need.
+func fetchMetricSteps(ctx context.Context, provider Provider, opts PipelineOptions) (map[string]MetricData, []AlertCoin, error) {
+	if isDirectExecution(ctx) {
+		results, coins := fetchMetricsDirect(ctx, provider, opts)
+		return results, coins, nil
+	}
+	if fetchMode == FetchModeUniverse {
+		fetched, err := step.Run(ctx, "fetch-universe", func(ctx context.Context) (universeFetch, error) {
+			results, coins := fetchMetricsFromUniverse(withoutProviderRetries(ctx), provider, opts)
+			fetched := universeFetch{Metrics: results, Coins: alertCoins(coins)}
+			for _, result := range results {
+				if result.Success {
+					return fetched, nil
+				}
+			}
+			return fetched, fmt.Errorf("universe fetch failed for all %d metrics", len(results))
+		})
+		if err != nil && !inngesterrors.IsStepError(err) {
+			return nil, nil, err
+		}
+		return fetched.Metrics, fetched.Coins, nil
+	}
+
+	fetches := make([]func(ctx context.Context) (any, error), len(opts.Metrics))
+	for i, sortType := range opts.Metrics {
+		fetches[i] = func(ctx context.Context) (any, error) {
+			result, err := step.Run(ctx, "fetch-"+sortType, func(ctx context.Context) (metricFetch, error) {
+				limit := opts.fetchLimit(sortableMetrics()[sortType])
+				result, coins := fetchMetricCoins(withoutProviderRetries(ctx), provider, sortType, limit)
+				if !result.Success {
+					return metricFetch{Metric: result}, fmt.Errorf("%s: %s", sortType, result.Error)
+				}
+				return metricFetch{Metric: result, Coins: alertCoins(coins)}, nil
+			})
+			if err != nil && !inngesterrors.IsStepError(err) {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	results := make(map[string]MetricData, len(opts.Metrics))
+	var coins []AlertCoin
+	for i, fetched := range group.Parallel(ctx, fetches...) {
+		if fetched.Error != nil {
+			return nil, nil, fetched.Error
+		}
+		result := fetched.Value.(metricFetch)
+		results[opts.Metrics[i]] = result.Metric
+		coins = append(coins, result.Coins...)
+	}
+	return results, coins, nil
+}
+
+// Step results; the coins travel with the metrics so alerts see every coin fetched
+type metricFetch struct {
+	Metric MetricData  `json:"metric"`
+	Coins  []AlertCoin `json:"coins,omitempty"`
+}
+
+type universeFetch struct {
+	Metrics map[string]MetricData `json:"metrics"`
+	Coins   []AlertCoin           `json:"coins,omitempty"`
+}
+
+// Fetch every metric concurrently without steps; the provider paces requests
+func fetchMetricsDirect(ctx context.Context, provider Provider, opts PipelineOptions) (map[string]MetricData, []AlertCoin) {
+	if fetchMode == FetchModeUniverse {
+		results, coins := fetchMetricsFromUniverse(ctx, provider, opts)
+		return results, alertCoins(coins)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := make(map[string]MetricData, len(opts.Metrics))
+	var coins []AlertCoin
+	for _, sortType := range opts.Metrics {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limit := opts.fetchLimit(sortableMetrics()[sortType])
+			result, fetched := fetchMetricCoins(ctx, provider, sortType, limit)
+
+			mu.Lock()
+			results[sortType] = result
+			coins = append(coins, alertCoins(fetched)...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results, coins
+}
+
+// Build one run from per-metric results
+func mergeMetricResults(results map[string]MetricData, fetchDuration time.Duration) CryptoDataResponse {
+	successful := 0
+	failed := 0
+	for _, result := range results {
+		if result.Success {
+			successful++
+		} else {
+			failed++
+		}
+	}
+
+	return CryptoDataResponse{
+		Timestamp:    time.Now(),
+		TotalMetrics: len(results),
+		AllMetrics:   results,
+		FetchStats: FetchStats{
+			TotalDurationMs:   fetchDuration.Milliseconds(),
+			SuccessfulFetches: successful,
+			FailedFetches:     failed,
+			LastUpdate:        time.Now().Format("2006-01-02 15:04:05"),
+		},
+	}
+}
+
+// Attach rank changes against the stored latest run, keep the last good data
+// for metrics that failed this time, and carry over the metrics this run
+// didn't refresh, so a partial refresh keeps the rest
+func mergeWithPrevious(data CryptoDataResponse) CryptoDataResponse {
+	previous, exists := getLatestDataFromRedis()
+	if !exists {
+		log.Printf("ℹ️  No previous run to compare against, skipping rank changes")
+		return data
+	}
+
+	applyRankChanges(&data, previous)
+	log.Printf("✅ Computed rank changes against run from %s (%s ago)",
+		previous.Timestamp.Format(time.RFC3339), time.Since(previous.Timestamp).Round(time.Second))
+
+	for sortType, metricData := range data.AllMetrics {
+		if metricData.Success {
+			continue
+		}
+		if kept, ok := keepLastGood(previous, sortType, metricData, data.Timestamp); ok {
+			data.AllMetrics[sortType] = kept
+		}
+	}
+
+	registry := sortableMetrics()
+	for sortType, metricData := range previous.AllMetrics {
+		if _, refreshed := data.AllMetrics[sortType]; refreshed {
+			continue
+		}
+		if _, enabled := registry[sortType]; enabled {
+			data.AllMetrics[sortType] = metricData
+		}
+	}
+	data.TotalMetrics = len(data.AllMetrics)
+	return data
+}
+
+// The previous run's data for a metric whose fetch just failed, marked stale.
+// False when there is nothing good to fall back to or it's past STALE_DATA_MAX_AGE.
+func keepLastGood(previous CryptoDataResponse, sortType string, failed MetricData, now time.Time) (MetricData, bool) {
+	lastGood, exists := previous.AllMetrics[sortType]
+	if !exists || !lastGood.Success {
+		return failed, false
+	}
+
+	updatedAt := previous.Timestamp
+	if lastGood.UpdatedAt != nil {
+		updatedAt = *lastGood.UpdatedAt
+	}
+	age := now.Sub(updatedAt)
+	if age > staleDataMaxAge {
+		log.Printf("⚠️  %s last good data is %s old, not keeping it", sortType, age.Round(time.Second))
+		return failed, false
+	}
+
+	lastGood.Stale = true
+	lastGood.StaleAgeSecs = int64(age.Seconds())
+	lastGood.UpdatedAt = &updatedAt
+	lastGood.Error = failed.Error
+	lastGood.FetchTimeMs = failed.FetchTimeMs
+	lastGood.Changes = nil // Nothing moved; the data is unchanged
+	lastGood.ComparedTo = nil
+	log.Printf("♻️  Keeping last good %s data (%s old): %s", sortType, age.Round(time.Second), failed.Error)
+	return lastGood, true
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Replay the recorded LunarCrush responses in testdata/fixtures through the
+// whole pipeline, with the in-memory store standing in for Redis
+
+func setupReplay(t *testing.T) Provider {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store = newFailoverStore(nil)
+
+	schedule, err := parseCron("*/5 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshSchedule = schedule
+	return newFixtureProvider("testdata/fixtures")
+}
+
+func runReplay(t *testing.T, provider Provider, opts PipelineOptions) PipelineResult {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(withDirectExecution(context.Background()), 10*time.Second)
+	defer cancel()
+
+	result, err := runPipeline(ctx, provider, opts)
+	if err != nil {
+		t.Fatalf("runPipeline: %v", err)
+	}
+	return result
+}
+
+func getCryptoData(t *testing.T) (int, CryptoDataWithFreshness) {
+	t.Helper()
+	r := gin.New()
+	r.GET("/api/crypto/data", requireAPIKey(), serveCryptoData)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/crypto/data", nil))
+
+	var body CryptoDataWithFreshness
+	if w.Code == 200 {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode /api/crypto/data: %v", err)
+		}
+	}
+	return w.Code, body
+}
+
+func symbols(data []CryptoData) []string {
+	out := make([]string, len(data))
+	for i, crypto := range data {
+		out[i] = crypto.Symbol
+	}
+	return out
+}
+
+func TestReplayPipelineServesFixtures(t *testing.T) {
+	provider := setupReplay(t)
+
+	result := runReplay(t, provider, PipelineOptions{Trigger: TriggerManual})
+	metrics := sortableMetrics()
+	if result.Status != "completed" || result.Generation != 1 {
+		t.Fatalf("status %q generation %d, want completed generation 1", result.Status, result.Generation)
+	}
+	if result.SuccessfulFetches != len(metrics) || result.FailedFetches != 0 {
+		t.Fatalf("%d successful, %d failed fetches, want %d and 0", result.SuccessfulFetches, result.FailedFetches, len(metrics))
+	}
+
+	status, data := getCryptoData(t)
+	if status != 200 {
+		t.Fatalf("GET /api/crypto/data: %d", status)
+	}
+	if data.Generation != 1 || data.Freshness.Stale {
+		t.Errorf("generation %d stale %v, want 1 and fresh", data.Generation, data.Freshness.Stale)
+	}
+	if len(data.AllMetrics) != len(metrics) {
+		t.Fatalf("%d metrics served, want %d", len(data.AllMetrics), len(metrics))
+	}
+	for sortType, metric := range data.AllMetrics {
+		if !metric.Success || metric.DataCount != 6 || len(metric.Top3Preview) != 3 {
+			t.Errorf("%s: success %v, %d coins, %d preview; want true, 6, 3", sortType, metric.Success, metric.DataCount, len(metric.Top3Preview))
+		}
+	}
+
+	tests := []struct {
+		metric string
+		want   []string
+	}{
+		{"market_cap", []string{"BTC", "ETH", "SOL", "XRP", "DOGE", "ADA"}},
+		{"alt_rank", []string{"DOGE", "SOL", "BTC", "ETH", "XRP", "ADA"}},
+		{"percent_change_24h", []string{"DOGE", "SOL", "ETH", "BTC", "ADA", "XRP"}},
+	}
+	for _, tt := range tests {
+		got := symbols(data.AllMetrics[tt.metric].AllData)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.metric, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.metric, got, tt.want)
+				break
+			}
+		}
+	}
+
+	btc := data.AllMetrics["market_cap"].AllData[0]
+	if btc.Rank != 1 || btc.RawValue == nil || *btc.RawValue != 1326000000000 {
+		t.Errorf("market_cap BTC: rank %d raw %v, want rank 1 raw 1.326e12", btc.Rank, btc.RawValue)
+	}
+}
+
+func TestReplayPipelineComparesToPreviousRun(t *testing.T) {
+	provider := setupReplay(t)
+
+	runReplay(t, provider, PipelineOptions{Trigger: TriggerCron})
+	result := runReplay(t, provider, PipelineOptions{Trigger: TriggerCron})
+	if result.Status != "completed" || result.Generation != 2 {
+		t.Fatalf("second run: status %q generation %d, want completed generation 2", result.Status, result.Generation)
+	}
+
+	_, data := getCryptoData(t)
+	changes := data.AllMetrics["market_cap"].Changes
+	if len(changes) != 6 {
+		t.Fatalf("market_cap: %d changes, want 6", len(changes))
+	}
+	for _, change := range changes {
+		if change.Movement != "same" || change.RankDelta != 0 {
+			t.Errorf("%s: %s by %d, want same", change.Symbol, change.Movement, change.RankDelta)
+		}
+	}
+}
+
+func TestReplayPipelineSingleMetric(t *testing.T) {
+	provider := setupReplay(t)
+
+	runReplay(t, provider, PipelineOptions{Trigger: TriggerCron})
+	result := runReplay(t, provider, PipelineOptions{Trigger: TriggerManual, Metrics: []string{"price"}, Limit: 2})
+	if result.Status != "completed" || result.TotalMetrics != 1 {
+		t.Fatalf("status %q with %d metrics, want completed with 1", result.Status, result.TotalMetrics)
+	}
+
+	// A smaller limit doesn't make the stored ranking shallower, so nothing is dropped
+	_, data := getCryptoData(t)
+	price := data.AllMetrics["price"]
+	if got := symbols(price.AllData); len(got) != 6 || got[0] != "BTC" || got[1] != "ETH" {
+		t.Errorf("price: got %v, want all 6 fixture coins", got)
+	}
+	for _, change := range price.Changes {
+		if change.Movement != MovementSame {
+			t.Errorf("%s: %s, want same", change.Symbol, change.Movement)
+		}
+	}
+}
+
+func TestPipelineFetchLimit(t *testing.T) {
+	config := MetricConfig{Limit: 50}
+	tests := []struct {
+		opts PipelineOptions
+		want int
+	}{
+		{PipelineOptions{}, 50},
+		{PipelineOptions{Limit: 10}, 50},
+		{PipelineOptions{Limit: 200}, 200},
+		{PipelineOptions{Limit: 10, DryRun: true}, 10},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.fetchLimit(config); got != tt.want {
+			t.Errorf("limit %d dry run %v: got %d, want %d", tt.opts.Limit, tt.opts.DryRun, got, tt.want)
+		}
+	}
+}
+
+func TestReplayPipelineDryRunStoresNothing(t *testing.T) {
+	provider := setupReplay(t)
+
+	result := runReplay(t, provider, PipelineOptions{Trigger: TriggerManual, DryRun: true})
+	if result.Status != "dry_run" {
+		t.Fatalf("status %q, want dry_run", result.Status)
+	}
+	if status, _ := getCryptoData(t); status != 404 {
+		t.Errorf("GET /api/crypto/data after a dry run: %d, want 404", status)
+	}
+	if _, running := pipelineLockHolder(context.Background()); running {
+		t.Error("dry run left the pipeline lock held")
+	}
+}
+
+func TestReplayPipelineSkipsWhileLocked(t *testing.T) {
+	provider := setupReplay(t)
+
+	if _, err := store.SetNX(context.Background(), pipelineLockKey, "99", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	result := runReplay(t, provider, PipelineOptions{Trigger: TriggerCron})
+	if result.Status != "skipped" {
+		t.Fatalf("status %q, want skipped", result.Status)
+	}
+	if status, _ := getCryptoData(t); status != 404 {
+		t.Errorf("GET /api/crypto/data after a skipped run: %d, want 404", status)
+	}
+	if holder, _ := pipelineLockHolder(context.Background()); holder != 99 {
+		t.Errorf("lock holder %d, want 99", holder)
+	}
+}
+
+func TestKeepLastGood(t *testing.T) {
+	now := time.Now()
+	fetchedAt := now.Add(-10 * time.Minute)
+	previous := CryptoDataResponse{
+		Timestamp: now.Add(-5 * time.Minute),
+		AllMetrics: map[string]MetricData{
+			"price":      {Success: true, AllData: ranked("BTC", "ETH"), UpdatedAt: &fetchedAt, Changes: []RankChange{{Symbol: "BTC"}}},
+			"volume_24h": {Success: false, Error: "earlier failure"},
+		},
+	}
+	failed := MetricData{Success: false, Error: "API returned status 500", FetchTimeMs: 12}
+
+	kept, ok := keepLastGood(previous, "price", failed, now)
+	if !ok {
+		t.Fatal("last good price data wasn't kept")
+	}
+	if !kept.Stale || kept.Error != failed.Error || kept.FetchTimeMs != 12 || len(kept.AllData) != 2 {
+		t.Errorf("kept %+v, want the previous data marked stale with the new error", kept)
+	}
+	if kept.StaleAgeSecs != 600 || !kept.UpdatedAt.Equal(fetchedAt) || kept.Changes != nil {
+		t.Errorf("age %ds updated %v changes %v, want 600s from the original fetch and no changes", kept.StaleAgeSecs, kept.UpdatedAt, kept.Changes)
+	}
+
+	if _, ok := keepLastGood(previous, "volume_24h", failed, now); ok {
+		t.Error("kept a metric that also failed last time")
+	}
+	if _, ok := keepLastGood(previous, "market_cap", failed, now); ok {
+		t.Error("kept a metric the previous run didn't have")
+	}
+	if _, ok := keepLastGood(previous, "price", failed, fetchedAt.Add(staleDataMaxAge+time.Second)); ok {
+		t.Error("kept data older than STALE_DATA_MAX_AGE")
+	}
+}
+
+func TestMergeWithPreviousKeepsLastGood(t *testing.T) {
+	store = newFailoverStore(nil)
+	stored := mergeMetricResults(map[string]MetricData{
+		"price":      {Success: true, AllData: ranked("BTC", "ETH")},
+		"volume_24h": {Success: true, AllData: ranked("ETH", "BTC")},
+	}, time.Second)
+	stored.Generation = 1
+	if !storeLatestDataInRedis(stored) {
+		t.Fatal("storing the previous run failed")
+	}
+
+	// This run only refreshed price, and that fetch failed
+	merged := mergeWithPrevious(mergeMetricResults(map[string]MetricData{
+		"price": {Success: false, Error: "timeout"},
+	}, time.Second))
+
+	price := merged.AllMetrics["price"]
+	if !price.Success || !price.Stale || price.Error != "timeout" {
+		t.Errorf("price: %+v, want the last good data marked stale", price)
+	}
+	if volume := merged.AllMetrics["volume_24h"]; !volume.Success || volume.Stale {
+		t.Errorf("volume_24h: %+v, want it carried over as is", volume)
+	}
+	if merged.TotalMetrics != 2 {
+		t.Errorf("total metrics %d, want 2", merged.TotalMetrics)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Provider is a market-data source that returns coins ranked by a sort key.
+// Coins are decoded into the LunarCrushCoin shape regardless of the source.
+type Provider interface {
+	Name() string
+	ListCoins(ctx context.Context, sort string, limit int) ([]LunarCrushCoin, error)
+}
+
+// LunarCrushProvider reads rankings from the LunarCrush coins/list/v2 API
+type LunarCrushProvider struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+	limiter *tokenBucket
+}
+
+func newLunarCrushProvider(apiKey string) *LunarCrushProvider {
+	return &LunarCrushProvider{
+		apiKey:  apiKey,
+		baseURL: "https://lunarcrush.com/api4/public",
+		client:  &http.Client{Timeout: 30 * time.Second},
+		limiter: newTokenBucketFromEnv(),
+	}
+}
+
+func (p *LunarCrushProvider) Name() string {
+	return "lunarcrush"
+}
+
+func (p *LunarCrushProvider) QuotaStatus() QuotaStatus {
+	return p.limiter.snapshot()
+}
+
+func (p *LunarCrushProvider) ListCoins(ctx context.Context, sort string, limit int) ([]LunarCrushCoin, error) {
+	body, err := p.fetchRaw(ctx, sort, limit)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLunarCrushResponse(body)
+}
+
+// ListCoinsPage returns one page (0-based) of a ranking
+func (p *LunarCrushProvider) ListCoinsPage(ctx context.Context, sort string, page, pageSize int) ([]LunarCrushCoin, error) {
+	body, err := p.fetchPageRaw(ctx, sort, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLunarCrushResponse(body)
+}
+
+// fetchRaw returns the undecoded response body so it can be recorded
+func (p *LunarCrushProvider) fetchRaw(ctx context.Context, sort string, limit int) ([]byte, error) {
+	return p.get(ctx, fmt.Sprintf("%s/coins/list/v2?sort=%s&limit=%d", p.baseURL, sort, limit))
+}
+
+// fetchPageRaw is fetchRaw for one page of a ranking
+func (p *LunarCrushProvider) fetchPageRaw(ctx context.Context, sort string, page, pageSize int) ([]byte, error) {
+	return p.get(ctx, fmt.Sprintf("%s/coins/list/v2?sort=%s&limit=%d&page=%d", p.baseURL, sort, pageSize, page))
+}
+
+type noProviderRetriesKey struct{}
+
+// Make the provider try each request once. Inngest steps retry on their own,
+// and retrying inside them as well multiplies the requests per failure.
+func withoutProviderRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noProviderRetriesKey{}, true)
+}
+
+func providerRetries(ctx context.Context, configured int) int {
+	if disabled, _ := ctx.Value(noProviderRetriesKey{}).(bool); disabled {
+		return 0
+	}
+	return configured
+}
+
+// get performs a rate-limited GET, retrying 429s and server errors with
+// backoff (honoring Retry-After when the API sends one)
+func (p *LunarCrushProvider) get(ctx context.Context, url string) ([]byte, error) {
+	maxRetries := providerRetries(ctx, p.limiter.maxRetries)
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			p.limiter.countRetry()
+		}
+		if err := p.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		body, resp, err := p.do(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if resp != nil && !retryableStatus(resp.StatusCode) {
+			return nil, err
+		}
+
+		delay := backoffDelay(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > maxRetryAfterWait {
+					p.limiter.pause(time.Now().Add(retryAfter))
+					return nil, fmt.Errorf("rate limited, retry after %s: %w", retryAfter, err)
+				}
+				delay = retryAfter
+			}
+			if resp.StatusCode == http.StatusTooManyRequests {
+				p.limiter.pause(time.Now().Add(delay))
+			}
+		}
+		if attempt == maxRetries {
+			break // The pause above still holds back the next caller
+		}
+
+		log.Printf("⏳ LunarCrush request failed (attempt %d/%d), retrying in %s: %v", attempt+1, maxRetries+1, delay.Round(time.Millisecond), err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// do sends one request. The response is returned alongside HTTP errors so the
+// caller can inspect the status and headers.
+func (p *LunarCrushProvider) do(ctx context.Context, url string) ([]byte, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch data: %w", err)
+	}
+	defer resp.Body.Close()
+	p.limiter.observe(resp)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, resp, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body[:min(200, len(body))]))
+	}
+
+	return body, resp, nil
+}
+
+func decodeLunarCrushResponse(body []byte) ([]LunarCrushCoin, error) {
+	var response LunarCrushResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return response.Data, nil
+}
+
+// Pick the data provider from DATA_PROVIDER (default "lunarcrush") and
+// PROVIDER_MODE: "live" (default), "record" (save raw responses to
+// FIXTURE_DIR) or "replay" (serve FIXTURE_DIR without network access)
+func newProviderFromEnv() (Provider, error) {
+	name := os.Getenv("DATA_PROVIDER")
+	if name == "" {
+		name = "lunarcrush"
+	}
+
+	mode := os.Getenv("PROVIDER_MODE")
+	if mode == "" {
+		mode = "live"
+	}
+
+	fixtureDir := os.Getenv("FIXTURE_DIR")
+	if fixtureDir == "" {
+		fixtureDir = "fixtures"
+	}
+
+	if mode == "replay" {
+		return newFixtureProvider(fixtureDir), nil
+	}
+	if mode != "live" && mode != "record" {
+		return nil, fmt.Errorf("unknown PROVIDER_MODE %q", mode)
+	}
+
+	switch name {
+	case "lunarcrush":
+		apiKey := os.Getenv("LUNARCRUSH_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("LUNARCRUSH_API_KEY environment variable is required")
+		}
+		live := newLunarCrushProvider(apiKey)
+		if mode == "record" {
+			return newRecordingProvider(live, fixtureDir)
+		}
+		return live, nil
+	default:
+		return nil, fmt.Errorf("unknown DATA_PROVIDER %q", name)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Outbound rate limiting for the LunarCrush API. Requests take a token from a
+// bucket sized to the plan (LUNARCRUSH_RATE_PER_MINUTE, LUNARCRUSH_BURST); a
+// 429 pauses the whole bucket until Retry-After so concurrent fetches back off
+// together instead of each hammering the API.
+const (
+	defaultRatePerMinute = 10
+	defaultBurst         = 5
+	defaultMaxRetries    = 4
+	backoffBase          = time.Second
+	backoffMax           = 30 * time.Second
+	maxRetryAfterWait    = time.Minute // Longer waits fail the request instead of blocking
+)
+
+// QuotaStatus is the client's view of the API quota, reported in /health
+type QuotaStatus struct {
+	RatePerMinute   float64    `json:"rate_per_minute"`
+	Burst           int        `json:"burst"`
+	TokensAvailable float64    `json:"tokens_available"`
+	PausedUntil     *time.Time `json:"paused_until,omitempty"`
+	Requests        int64      `json:"requests"`
+	Throttled       int64      `json:"throttled"` // 429 responses
+	Retries         int64      `json:"retries"`
+	LastStatus      int        `json:"last_status,omitempty"`
+	RemainingQuota  *int       `json:"remaining_quota,omitempty"` // From X-RateLimit-Remaining, when sent
+	LastThrottledAt *time.Time `json:"last_throttled_at,omitempty"`
+}
+
+// QuotaReporter is implemented by providers that track an upstream quota
+type QuotaReporter interface {
+	QuotaStatus() QuotaStatus
+}
+
+type tokenBucket struct {
+	mu          sync.Mutex
+	rate        float64 // Tokens per second
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	maxRetries  int
+	status      QuotaStatus
+}
+
+func newTokenBucket(perMinute float64, burst, maxRetries int) *tokenBucket {
+	return &tokenBucket{
+		rate:       perMinute / 60,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		last:       time.Now(),
+		maxRetries: maxRetries,
+		status:     QuotaStatus{RatePerMinute: perMinute, Burst: burst},
+	}
+}
+
+func newTokenBucketFromEnv() *tokenBucket {
+	perMinute := float64(intFromEnv("LUNARCRUSH_RATE_PER_MINUTE", defaultRatePerMinute))
+	burst := intFromEnv("LUNARCRUSH_BURST", defaultBurst)
+	maxRetries := defaultMaxRetries
+	if value := os.Getenv("LUNARCRUSH_MAX_RETRIES"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			maxRetries = n
+		}
+	}
+	return newTokenBucket(perMinute, burst, maxRetries)
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Block until a token is available or ctx is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.refill(now)
+
+		var delay time.Duration
+		switch {
+		case now.Before(b.pausedUntil):
+			delay = b.pausedUntil.Sub(now)
+		case b.tokens >= 1:
+			b.tokens--
+			b.status.Requests++
+			b.mu.Unlock()
+			return nil
+		default:
+			delay = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		}
+		b.mu.Unlock()
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Stop handing out tokens until the given time
+func (b *tokenBucket) pause(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+	b.tokens = 0
+}
+
+// Record a response's status and any quota headers
+func (b *tokenBucket) observe(resp *http.Response) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.LastStatus = resp.StatusCode
+	if resp.StatusCode == http.StatusTooManyRequests {
+		b.status.Throttled++
+		now := time.Now()
+		b.status.LastThrottledAt = &now
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		b.status.RemainingQuota = &remaining
+	}
+}
+
+func (b *tokenBucket) countRetry() {
+	b.mu.Lock()
+	b.status.Retries++
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) snapshot() QuotaStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.refill(now)
+
+	status := b.status
+	status.TokensAvailable = math.Floor(b.tokens*100) / 100
+	if now.Before(b.pausedUntil) {
+		until := b.pausedUntil
+		status.PausedUntil = &until
+	}
+	return status
+}
+
+// Exponential backoff with jitter: a random delay in [d/2, d], d = base·2^attempt
+func backoffDelay(attempt int) time.Duration {
+	d := backoffBase << attempt
+	if d <= 0 || d > backoffMax {
+		d = backoffMax
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Retry-After as seconds or an HTTP date; false when absent or unparseable
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for rate limit: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 6, 26, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"30", 30 * time.Second, true},
+		{"0", 0, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true}, // Already passed
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q): got %s %v, want %s %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTokenBucketBurstThenRate(t *testing.T) {
+	bucket := newTokenBucket(600, 2, 0) // 10 per second after a burst of 2
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := bucket.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("third request went out after %s, want it held for a refill (~100ms)", elapsed)
+	}
+	if status := bucket.snapshot(); status.Requests != 3 {
+		t.Errorf("counted %d requests, want 3", status.Requests)
+	}
+}
+
+func TestTokenBucketPauseAndCancel(t *testing.T) {
+	bucket := newTokenBucket(600, 5, 0)
+	bucket.pause(time.Now().Add(time.Hour))
+
+	if status := bucket.snapshot(); status.PausedUntil == nil {
+		t.Error("paused bucket doesn't report paused_until")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := bucket.wait(ctx); err == nil {
+		t.Error("wait returned a token while paused")
+	}
+}
+
+func TestProviderRetriesOnlyOutsideSteps(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	provider := newLunarCrushProvider("test-key")
+	provider.baseURL = upstream.URL
+	provider.limiter = newTokenBucket(6000, 10, 2)
+
+	if _, err := provider.ListCoins(context.Background(), "price", 10); err == nil {
+		t.Fatal("failing upstream returned no error")
+	}
+	if got := requests.Swap(0); got != 3 {
+		t.Errorf("direct call made %d requests, want 3 (1 + 2 retries)", got)
+	}
+
+	if _, err := provider.ListCoins(withoutProviderRetries(context.Background()), "price", 10); err == nil {
+		t.Fatal("failing upstream returned no error")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("step call made %d requests, want 1", got)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Redis health monitoring: a background loop pings Redis every
+// REDIS_HEALTH_INTERVAL, moves storage to memory when pings fail and back to
+// Redis when they succeed again, and records what it saw for /health and /ready.
+const redisPingTimeout = 5 * time.Second
+
+// READY_REQUIRES_REDIS=false lets /ready pass while running on the memory fallback
+var readyRequiresRedis = true
+
+// RedisHealth is the Redis section of /health
+type RedisHealth struct {
+	Enabled             bool       `json:"enabled"`
+	Connected           bool       `json:"connected"`
+	Storage             string     `json:"storage"`
+	LatencyMs           float64    `json:"latency_ms"`     // Last successful ping
+	AvgLatencyMs        float64    `json:"avg_latency_ms"` // Moving average of successful pings
+	LastCheck           *time.Time `json:"last_check,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	DownSince           *time.Time `json:"down_since,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	ReconnectAttempts   int64      `json:"reconnect_attempts"`
+	Reconnects          int64      `json:"reconnects"`
+}
+
+type redisHealthState struct {
+	mu     sync.Mutex
+	health RedisHealth
+}
+
+var redisHealth = &redisHealthState{}
+
+func (h *redisHealthState) recordPing(latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.health.LastCheck = &now
+	if err != nil {
+		h.recordErrorLocked(err, now)
+		h.health.ConsecutiveFailures++
+		return
+	}
+
+	ms := float64(latency.Microseconds()) / 1000
+	if h.health.LastSuccess == nil {
+		h.health.AvgLatencyMs = ms
+	} else {
+		h.health.AvgLatencyMs = 0.8*h.health.AvgLatencyMs + 0.2*ms
+	}
+	h.health.LatencyMs = ms
+	h.health.LastSuccess = &now
+	h.health.ConsecutiveFailures = 0
+}
+
+// An error from a ping or from a storage command
+func (h *redisHealthState) recordError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recordErrorLocked(err, time.Now())
+}
+
+func (h *redisHealthState) recordErrorLocked(err error, now time.Time) {
+	h.health.LastError = err.Error()
+	h.health.LastErrorAt = &now
+	if h.health.DownSince == nil {
+		h.health.DownSince = &now
+	}
+}
+
+func (h *redisHealthState) recordReconnect(attempted, succeeded bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if attempted {
+		h.health.ReconnectAttempts++
+	}
+	if succeeded {
+		h.health.Reconnects++
+		h.health.DownSince = nil
+	}
+}
+
+func (h *redisHealthState) snapshot() RedisHealth {
+	h.mu.Lock()
+	health := h.health
+	h.mu.Unlock()
+
+	health.Enabled = store.redis != nil
+	health.Connected = store.redisAvailable()
+	health.Storage = store.Name()
+	if health.Connected {
+		health.DownSince = nil
+	}
+	return health
+}
+
+// Ping Redis once and switch storage to match the result
+func checkRedis() {
+	if store.redis == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisPingTimeout)
+	defer cancel()
+
+	wasUp := store.up.Load()
+	start := time.Now()
+	err := store.redis.client.Ping(ctx).Err()
+	redisHealth.recordPing(time.Since(start), err)
+
+	switch {
+	case err != nil && wasUp:
+		store.markDown(err)
+	case err != nil:
+		redisHealth.recordReconnect(true, false)
+		log.Printf("🔌 Redis still unavailable: %v", err)
+	case !wasUp:
+		store.markUp(ctx)
+		redisHealth.recordReconnect(true, store.up.Load())
+	}
+}
+
+func monitorRedis(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		checkRedis()
+	}
+}
+
+// Readiness: can this instance serve consistent data? Redis must be connected
+// unless it's disabled or READY_REQUIRES_REDIS=false (the memory fallback is
+// then good enough), and at least one metric must be enabled.
+func readiness() (bool, map[string]string) {
+	checks := map[string]string{}
+	ready := true
+
+	switch {
+	case store.redis == nil:
+		checks["storage"] = "memory (redis disabled)"
+	case store.redisAvailable():
+		checks["storage"] = "redis"
+	case !readyRequiresRedis:
+		checks["storage"] = "memory (redis down, fallback allowed)"
+	default:
+		checks["storage"] = "redis down"
+		ready = false
+	}
+
+	if len(sortableMetrics()) == 0 {
+		checks["metrics"] = "no metrics enabled"
+		ready = false
+	} else {
+		checks["metrics"] = "ok"
+	}
+
+	// Informational: an instance without data yet can still take traffic
+	if _, exists := getLatestDataFromRedis(); exists {
+		checks["data"] = "ok"
+	} else {
+		checks["data"] = "none yet"
+	}
+
+	return ready, checks
+}
+
+// GET /ready
+func serveReadiness(c *gin.Context) {
+	ready, checks := readiness()
+	status := 200
+	if !ready {
+		status = 503
+	}
+	c.JSON(status, gin.H{"ready": ready, "checks": checks})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadinessFollowsRedisHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s, server := newTestFailoverStore(t)
+	store = s
+	redisHealth = &redisHealthState{}
+	defer func(required bool) { readyRequiresRedis = required }(readyRequiresRedis)
+	readyRequiresRedis = true
+
+	r := gin.New()
+	r.GET("/ready", serveReadiness)
+	ready := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+
+	checkRedis()
+	if code := ready(); code != 200 {
+		t.Fatalf("Redis up: /ready answered %d, want 200", code)
+	}
+	if health := redisHealth.snapshot(); !health.Connected || health.LastSuccess == nil || health.ConsecutiveFailures != 0 {
+		t.Errorf("Redis up: health %+v", health)
+	}
+
+	server.Close()
+	checkRedis()
+	checkRedis()
+	if code := ready(); code != 503 {
+		t.Fatalf("Redis down: /ready answered %d, want 503", code)
+	}
+	health := redisHealth.snapshot()
+	if health.Connected || health.Storage != "memory" || health.DownSince == nil || health.ConsecutiveFailures != 2 || health.ReconnectAttempts != 1 {
+		t.Errorf("Redis down: health %+v", health)
+	}
+
+	readyRequiresRedis = false
+	if code := ready(); code != 200 {
+		t.Errorf("Redis down with the fallback allowed: /ready answered %d, want 200", code)
+	}
+	readyRequiresRedis = true
+
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	checkRedis()
+	if code := ready(); code != 200 {
+		t.Fatalf("Redis back: /ready answered %d, want 200", code)
+	}
+	health = redisHealth.snapshot()
+	if !health.Connected || health.Storage != "redis" || health.DownSince != nil || health.ConsecutiveFailures != 0 || health.Reconnects != 1 {
+		t.Errorf("Redis back: health %+v", health)
+	}
+}
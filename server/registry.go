@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MetricRegistryFile is the on-disk registry (METRICS_REGISTRY_FILE, YAML or JSON)
+type MetricRegistryFile struct {
+	Metrics map[string]MetricConfig `json:"metrics" yaml:"metrics"`
+}
+
+// metricRegistry is an immutable view of the registry; reloads swap in a new one
+type metricRegistry struct {
+	metrics  map[string]MetricConfig // Enabled metrics only
+	disabled []string
+	source   string
+	loadedAt time.Time
+	modTime  time.Time
+}
+
+var currentRegistry atomic.Pointer[metricRegistry]
+
+var (
+	metricKeyPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+	validFormats     = map[string]bool{FormatUSDCompact: true, FormatUSD: true, FormatInteger: true, FormatPercent: true, FormatCompact: true, FormatSupply: true, FormatDecimal: true}
+	validUnits       = map[string]bool{UnitCurrency: true, UnitPercent: true, UnitRank: true, UnitCount: true, UnitTokens: true}
+	validPriorities  = map[string]bool{"high": true, "medium": true, "low": true}
+)
+
+// sortableMetrics returns the enabled metrics. The map is shared and must not be modified.
+func sortableMetrics() map[string]MetricConfig {
+	if registry := currentRegistry.Load(); registry != nil {
+		return registry.metrics
+	}
+	return defaultSortableMetrics
+}
+
+func metricRegistryInfo() map[string]interface{} {
+	registry := currentRegistry.Load()
+	if registry == nil {
+		return map[string]interface{}{"source": "built-in"}
+	}
+	return map[string]interface{}{
+		"source":    registry.source,
+		"loaded_at": registry.loadedAt,
+		"disabled":  registry.disabled,
+	}
+}
+
+func metricRegistryPath() string {
+	if path := os.Getenv("METRICS_REGISTRY_FILE"); path != "" {
+		return path
+	}
+	return "metrics.yaml"
+}
+
+// Load the registry at startup and start watching it. A missing file means the
+// built-in metrics are used; an invalid file is fatal.
+func loadMetricRegistry() {
+	path := metricRegistryPath()
+
+	registry, err := readMetricRegistry(path)
+	if errors.Is(err, os.ErrNotExist) {
+		currentRegistry.Store(&metricRegistry{metrics: defaultSortableMetrics, disabled: []string{}, source: "built-in", loadedAt: time.Now()})
+		log.Printf("ℹ️  No metric registry at %s, using %d built-in metrics", path, len(defaultSortableMetrics))
+		return
+	}
+	if err != nil {
+		log.Fatal("Invalid metric registry: ", err)
+	}
+
+	currentRegistry.Store(registry)
+	log.Printf("✅ Loaded %d metrics from %s (%d disabled)", len(registry.metrics), path, len(registry.disabled))
+
+	go watchMetricRegistry(path, durationFromEnv("METRICS_RELOAD_INTERVAL", 30*time.Second))
+}
+
+func readMetricRegistry(path string) (*metricRegistry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file MetricRegistryFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(raw)))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&file)
+	default:
+		decoder := json.NewDecoder(strings.NewReader(string(raw)))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	registry := &metricRegistry{
+		metrics:  map[string]MetricConfig{},
+		disabled: []string{},
+		source:   path,
+		loadedAt: time.Now(),
+		modTime:  info.ModTime(),
+	}
+	for key, config := range file.Metrics {
+		if err := validateMetricConfig(key, config); err != nil {
+			return nil, fmt.Errorf("%s: metric %q: %w", path, key, err)
+		}
+		if config.Disabled {
+			registry.disabled = append(registry.disabled, key)
+			continue
+		}
+		registry.metrics[key] = config
+	}
+	sort.Strings(registry.disabled)
+
+	if len(registry.metrics) == 0 {
+		return nil, fmt.Errorf("%s: no enabled metrics", path)
+	}
+	return registry, nil
+}
+
+func validateMetricConfig(key string, config MetricConfig) error {
+	switch {
+	case !metricKeyPattern.MatchString(key):
+		return fmt.Errorf("key must be lowercase letters, digits and underscores")
+	case config.Name == "":
+		return fmt.Errorf("name is required")
+	case config.Field == "":
+		return fmt.Errorf("field is required")
+	case !validPriorities[config.Priority]:
+		return fmt.Errorf("priority must be high, medium or low")
+	case !validFormats[config.Format]:
+		return fmt.Errorf("unknown format %q", config.Format)
+	case config.Unit != "" && !validUnits[config.Unit]:
+		return fmt.Errorf("unknown unit %q", config.Unit)
+	case config.Unit == UnitCurrency && config.Currency == "":
+		return fmt.Errorf("currency is required for unit %q", UnitCurrency)
+	case config.Limit < 0 || config.Limit > maxFetchLimit:
+		return fmt.Errorf("limit must be between 1 and %d (or 0 for the default)", maxFetchLimit)
+	}
+	return nil
+}
+
+// Reload when the file changes on disk or on SIGHUP. An invalid edit is logged
+// and the previous registry stays in place.
+func watchMetricRegistry(path string, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		force := false
+		select {
+		case <-ticker.C:
+		case <-hangup:
+			force = true
+		}
+		reloadMetricRegistry(path, force)
+	}
+}
+
+// Swap in the registry from path if the file changed (or force is set). False
+// when nothing was reloaded.
+func reloadMetricRegistry(path string, force bool) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("⚠️  Metric registry %s unavailable, keeping current metrics: %v", path, err)
+		return false
+	}
+	if current := currentRegistry.Load(); !force && current != nil && info.ModTime().Equal(current.modTime) {
+		return false
+	}
+
+	registry, err := readMetricRegistry(path)
+	if err != nil {
+		log.Printf("❌ Metric registry reload failed, keeping current metrics: %v", err)
+		return false
+	}
+	currentRegistry.Store(registry)
+	log.Printf("🔄 Reloaded %d metrics from %s (%d disabled)", len(registry.metrics), path, len(registry.disabled))
+	return true
+}
+
+// UnmarshalJSON decodes the typed fields and also keeps every numeric field in
+// Fields. Nulls and non-numbers are left out, so fieldValue reports them missing.
+func (c *LunarCrushCoin) UnmarshalJSON(data []byte) error {
+	type plain LunarCrushCoin
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if c.Fields == nil {
+		c.Fields = make(map[string]float64, len(raw))
+	}
+	for key, value := range raw {
+		var decoded interface{}
+		if json.Unmarshal(value, &decoded) != nil {
+			continue
+		}
+		if number, ok := decoded.(float64); ok { // Skips null, strings, objects...
+			c.Fields[key] = number
+		}
+	}
+	return nil
+}
+
+// fieldValue looks up a LunarCrush field by name, falling back to the typed
+// fields for coins that weren't decoded from JSON
+func (c LunarCrushCoin) fieldValue(field string) (float64, bool) {
+	if c.Fields != nil {
+		value, ok := c.Fields[field]
+		return value, ok
+	}
+
+	switch field {
+	case "market_cap":
+		return c.MarketCap, true
+	case "price":
+		return c.Price, true
+	case "volume_24h":
+		return c.Volume24h, true
+	case "percent_change_1h":
+		return c.PercentChange1h, true
+	case "percent_change_24h":
+		return c.PercentChange24h, true
+	case "percent_change_7d":
+		return c.PercentChange7d, true
+	case "alt_rank":
+		return float64(c.AltRank), true
+	}
+
+	var pointer *float64
+	switch field {
+	case "interactions_24h":
+		pointer = c.Interactions24h
+	case "social_dominance":
+		pointer = c.SocialDominance
+	case "circulating_supply":
+		pointer = c.CirculatingSupply
+	case "market_dominance":
+		pointer = c.MarketDominance
+	}
+	if pointer == nil {
+		return 0, false
+	}
+	return *pointer, true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeRegistry(t *testing.T, path, body string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadMetricRegistryExample(t *testing.T) {
+	registry, err := readMetricRegistry("metrics.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.metrics) != len(defaultSortableMetrics) {
+		t.Errorf("got %d metrics, want the %d built-in ones", len(registry.metrics), len(defaultSortableMetrics))
+	}
+	if registry.metrics["market_cap"].Limit != 100 {
+		t.Errorf("market_cap limit %d, want 100", registry.metrics["market_cap"].Limit)
+	}
+}
+
+func TestReadMetricRegistryJSONAndDisabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	writeRegistry(t, path, `{"metrics": {
+		"price": {"name": "Price", "field": "price", "priority": "high", "format": "usd", "unit": "currency", "currency": "USD"},
+		"galaxy_score": {"name": "Galaxy Score", "field": "galaxy_score", "priority": "low", "format": "decimal", "disabled": true}
+	}}`, time.Now())
+
+	registry, err := readMetricRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, enabled := registry.metrics["galaxy_score"]; enabled || len(registry.disabled) != 1 {
+		t.Errorf("galaxy_score: enabled %v, disabled %v, want it disabled", enabled, registry.disabled)
+	}
+	if len(registry.metrics) != 1 {
+		t.Errorf("got %d enabled metrics, want 1", len(registry.metrics))
+	}
+}
+
+func TestReadMetricRegistryRejectsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":  "metrics:\n  price: {name: Price, field: price, priority: high, format: usd, colour: red}\n",
+		"bad key":        "metrics:\n  Price: {name: Price, field: price, priority: high, format: usd}\n",
+		"missing field":  "metrics:\n  price: {name: Price, priority: high, format: usd}\n",
+		"unknown format": "metrics:\n  price: {name: Price, field: price, priority: high, format: roman}\n",
+		"no currency":    "metrics:\n  price: {name: Price, field: price, priority: high, format: usd, unit: currency}\n",
+		"limit too big":  "metrics:\n  price: {name: Price, field: price, priority: high, format: usd, limit: 100000}\n",
+		"all disabled":   "metrics:\n  price: {name: Price, field: price, priority: high, format: usd, disabled: true}\n",
+	}
+	for name, body := range tests {
+		path := filepath.Join(t.TempDir(), "metrics.yaml")
+		writeRegistry(t, path, body, time.Now())
+		if _, err := readMetricRegistry(path); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestReloadMetricRegistry(t *testing.T) {
+	defer currentRegistry.Store(currentRegistry.Load())
+
+	path := filepath.Join(t.TempDir(), "metrics.yaml")
+	loaded := time.Now().Add(-time.Hour)
+	writeRegistry(t, path, "metrics:\n  price: {name: Price, field: price, priority: high, format: usd, unit: currency, currency: USD}\n", loaded)
+	registry, err := readMetricRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentRegistry.Store(registry)
+
+	if reloadMetricRegistry(path, false) {
+		t.Error("reloaded an unchanged file")
+	}
+
+	// A broken edit keeps the current registry
+	writeRegistry(t, path, "metrics:\n  price: {name: Price}\n", loaded.Add(time.Minute))
+	if reloadMetricRegistry(path, false) || sortableMetrics()["price"].Field != "price" {
+		t.Error("invalid edit replaced the registry")
+	}
+
+	writeRegistry(t, path, "metrics:\n  price: {name: Price, field: price, priority: high, format: usd, unit: currency, currency: USD}\n  volume_24h: {name: 24h Volume, field: volume_24h, priority: high, format: usd_compact, unit: currency, currency: USD}\n", loaded.Add(2*time.Minute))
+	if !reloadMetricRegistry(path, false) {
+		t.Fatal("changed file wasn't reloaded")
+	}
+	if _, exists := sortableMetrics()["volume_24h"]; !exists {
+		t.Error("reloaded registry is missing volume_24h")
+	}
+
+	// SIGHUP reloads even when the file looks unchanged
+	if !reloadMetricRegistry(path, true) {
+		t.Error("forced reload was skipped")
+	}
+}
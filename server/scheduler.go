@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler backends (SCHEDULER). "inngest" runs the pipeline as Inngest
+// functions; "standalone" runs it in-process on REFRESH_CRON, so a local or
+// self-hosted deployment works without an Inngest server. With several
+// standalone instances, a Redis lease picks the one that runs scheduled refreshes.
+const (
+	SchedulerInngest    = "inngest"
+	SchedulerStandalone = "standalone"
+)
+
+const (
+	schedulerLeaderKey   = "crypto:scheduler:leader"
+	standaloneRunTimeout = 10 * time.Minute
+)
+
+var (
+	schedulerMode     = SchedulerInngest
+	refreshSchedule   *cronSchedule
+	schedulerJitter   = 30 * time.Second // SCHEDULER_JITTER
+	schedulerLeaseTTL = time.Minute      // SCHEDULER_LEASE_TTL
+)
+
+func initSchedulerConfig() {
+	if mode := os.Getenv("SCHEDULER"); mode != "" {
+		if mode != SchedulerInngest && mode != SchedulerStandalone {
+			log.Fatalf("Unknown SCHEDULER %q (use %s or %s)", mode, SchedulerInngest, SchedulerStandalone)
+		}
+		schedulerMode = mode
+	}
+
+	expr := os.Getenv("REFRESH_CRON")
+	if expr == "" {
+		expr = "*/5 * * * *"
+	}
+	schedule, err := parseCron(expr)
+	if err != nil {
+		log.Fatal("Invalid REFRESH_CRON: ", err)
+	}
+	refreshSchedule = schedule
+
+	schedulerJitter = durationFromEnv("SCHEDULER_JITTER", schedulerJitter)
+	schedulerLeaseTTL = durationFromEnv("SCHEDULER_LEASE_TTL", schedulerLeaseTTL)
+	log.Printf("✅ Scheduler: %s (%s)", schedulerMode, refreshSchedule.expr)
+}
+
+// leaderLease is held by at most one standalone instance at a time. The
+// holder renews it every third of its TTL; if it dies, another instance takes
+// over once the lease expires. While Redis is down every instance leads.
+type leaderLease struct {
+	id     string
+	ttl    time.Duration
+	leader atomic.Bool
+}
+
+func newLeaderLease(ttl time.Duration) *leaderLease {
+	hostname, _ := os.Hostname()
+	return &leaderLease{id: hostname + "-" + randomHex(4), ttl: ttl}
+}
+
+func (l *leaderLease) isLeader() bool {
+	return l.leader.Load()
+}
+
+func (l *leaderLease) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if l.leader.Load() {
+		renewed, err := store.CompareAndExpire(ctx, schedulerLeaderKey, l.id, l.ttl)
+		if err == nil && renewed {
+			return
+		}
+		l.leader.Store(false)
+		log.Printf("⚠️  Lost scheduler leadership (%s)", l.id)
+	}
+
+	acquired, err := store.SetNX(ctx, schedulerLeaderKey, l.id, l.ttl)
+	if err != nil {
+		log.Printf("⚠️  Scheduler leader check failed: %v", err)
+		return
+	}
+	if acquired {
+		l.leader.Store(true)
+		log.Printf("👑 Became scheduler leader (%s)", l.id)
+	}
+}
+
+func (l *leaderLease) run() {
+	l.refresh()
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.refresh()
+	}
+}
+
+// Run scheduled refreshes in-process until the server exits
+func startStandaloneScheduler(provider Provider) {
+	lease := newLeaderLease(schedulerLeaseTTL)
+	go lease.run()
+
+	go func() {
+		for {
+			next := refreshSchedule.next(time.Now())
+			if next.IsZero() {
+				log.Printf("⚠️  REFRESH_CRON %q never fires, scheduler stopped", refreshSchedule.expr)
+				return
+			}
+
+			// Jitter spreads instances (and upstream load) away from the exact tick
+			var jitter time.Duration
+			if schedulerJitter > 0 {
+				jitter = rand.N(schedulerJitter)
+			}
+			time.Sleep(time.Until(next) + jitter)
+
+			if !lease.isLeader() {
+				log.Printf("⏭️  Skipping scheduled refresh, %s is not the leader", lease.id)
+				continue
+			}
+			runPipelineDirect(provider, PipelineOptions{Trigger: TriggerCron})
+		}
+	}()
+
+	log.Printf("⏰ Standalone scheduler started: %s (jitter up to %s)", refreshSchedule.expr, schedulerJitter)
+}
+
+// Run the pipeline in-process, outside Inngest
+func runPipelineDirect(provider Provider, opts PipelineOptions) {
+	ctx, cancel := context.WithTimeout(withDirectExecution(context.Background()), standaloneRunTimeout)
+	defer cancel()
+
+	result, err := runPipeline(ctx, provider, opts)
+	if err != nil {
+		log.Printf("❌ %s refresh failed: %v", opts.Trigger, err)
+		return
+	}
+	log.Printf("✅ %s refresh %s: %d successful, %d failed in %dms",
+		result.Trigger, result.Status, result.SuccessfulFetches, result.FailedFetches, result.TotalDurationMs)
+}
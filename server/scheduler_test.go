@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaderLeaseHasOneHolder(t *testing.T) {
+	s, server := newTestFailoverStore(t)
+	store = s
+	a, b := newLeaderLease(time.Minute), newLeaderLease(time.Minute)
+
+	a.refresh()
+	b.refresh()
+	if !a.isLeader() || b.isLeader() {
+		t.Fatalf("first refresh: a leader %v, b leader %v; want only a", a.isLeader(), b.isLeader())
+	}
+
+	// Renewing keeps the lease alive past its original TTL
+	server.FastForward(40 * time.Second)
+	a.refresh()
+	server.FastForward(40 * time.Second)
+	b.refresh()
+	if !a.isLeader() || b.isLeader() {
+		t.Errorf("after renewal: a leader %v, b leader %v; want only a", a.isLeader(), b.isLeader())
+	}
+	if holder, _ := server.Get(schedulerLeaderKey); holder != a.id {
+		t.Errorf("lease held by %q, want %q", holder, a.id)
+	}
+}
+
+func TestLeaderLeaseExpiresAndIsTakenOver(t *testing.T) {
+	s, server := newTestFailoverStore(t)
+	store = s
+	a, b := newLeaderLease(time.Minute), newLeaderLease(time.Minute)
+
+	a.refresh()
+	if !a.isLeader() {
+		t.Fatal("a didn't take the free lease")
+	}
+
+	// a stops renewing, say it hung; b takes over once the lease expires
+	server.FastForward(59 * time.Second)
+	b.refresh()
+	if b.isLeader() {
+		t.Fatal("b took the lease before it expired")
+	}
+	server.FastForward(2 * time.Second)
+	b.refresh()
+	if !b.isLeader() {
+		t.Fatal("b didn't take over the expired lease")
+	}
+
+	// a notices on its next refresh and steps down
+	a.refresh()
+	if a.isLeader() {
+		t.Error("a still leads after losing the lease")
+	}
+	if holder, _ := server.Get(schedulerLeaderKey); holder != b.id {
+		t.Errorf("lease held by %q, want %q", holder, b.id)
+	}
+}
+
+func TestConfiguredScheduleNextFire(t *testing.T) {
+	defer func(schedule *cronSchedule) { refreshSchedule = schedule }(refreshSchedule)
+
+	tests := []struct {
+		cron  string
+		after string
+		want  string
+	}{
+		{"", "2026-10-16T12:03:30Z", "2026-10-16T12:05:00Z"}, // Default every 5 minutes
+		{"15 */2 * * *", "2026-10-16T12:20:00Z", "2026-10-16T14:15:00Z"},
+		{"0 6 * * 1", "2026-10-16T12:00:00Z", "2026-10-19T06:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Setenv("REFRESH_CRON", tt.cron)
+		initSchedulerConfig()
+		if got := refreshSchedule.next(utc(tt.after)); !got.Equal(utc(tt.want)) {
+			t.Errorf("REFRESH_CRON=%q after %s: got %s, want %s", tt.cron, tt.after, got.Format(time.RFC3339), tt.want)
+		}
+	}
+}
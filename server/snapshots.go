@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snapshot storage: every run is kept under its own timestamped key and indexed
+// in a sorted set (score = unix seconds) so we can look back at past rankings.
+const (
+	snapshotIndexKey  = "crypto:snapshots"
+	snapshotKeyPrefix = "crypto:snapshot:"
+)
+
+// How long snapshots are kept (SNAPSHOT_RETENTION). A full-depth run (11
+// metrics, 25-100 coins each) is ~100KB; compacted it is ~55KB, so a day of
+// 5-minute snapshots is ~16MB and fits next to everything else in a 30MB Redis.
+var snapshotRetention = 24 * time.Hour
+
+// SnapshotInfo is a lightweight entry in the snapshot index
+type SnapshotInfo struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        string    `json:"id"`
+}
+
+func initSnapshotConfig() {
+	snapshotRetention = durationFromEnv("SNAPSHOT_RETENTION", snapshotRetention)
+	log.Printf("✅ Snapshot retention: %s", snapshotRetention)
+}
+
+func snapshotID(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func snapshotKey(id string) string {
+	return snapshotKeyPrefix + id
+}
+
+// Snapshots leave out what can be rebuilt on read: rank changes (ComparedTo
+// is kept, to find the run they were computed against), the top-3 preview
+// and metric descriptions
+func compactSnapshot(data CryptoDataResponse) CryptoDataResponse {
+	metrics := make(map[string]MetricData, len(data.AllMetrics))
+	for sortType, metricData := range data.AllMetrics {
+		metricData.Changes = nil
+		metricData.Top3Preview = nil
+		metricData.Description = ""
+		metrics[sortType] = metricData
+	}
+	data.AllMetrics = metrics
+	return data
+}
+
+// Restore what compactSnapshot dropped. Rank changes are computed again
+// against the snapshot of the run they were compared to; when that one has
+// expired the metric is returned without them.
+func expandSnapshot(data CryptoDataResponse) CryptoDataResponse {
+	registry := sortableMetrics()
+	previous := map[string]CryptoDataResponse{}
+	for sortType, metricData := range data.AllMetrics {
+		if metricData.Top3Preview == nil {
+			metricData.Top3Preview = metricData.AllData[:min(3, len(metricData.AllData))]
+		}
+		if metricData.Description == "" {
+			metricData.Description = registry[sortType].Description
+		}
+
+		if metricData.ComparedTo != nil && metricData.Changes == nil {
+			id := snapshotID(*metricData.ComparedTo)
+			before, loaded := previous[id]
+			if !loaded {
+				before, _ = loadSnapshot(id)
+				previous[id] = before
+			}
+			if previousData, exists := before.AllMetrics[sortType]; exists && previousData.Success {
+				metricData.Changes = computeRankChanges(metricData.AllData, previousData.AllData)
+			} else {
+				metricData.ComparedTo = nil
+			}
+		}
+		data.AllMetrics[sortType] = metricData
+	}
+	return data
+}
+
+// Store a run as a timestamped snapshot and prune entries past the retention window
+func storeSnapshotInRedis(data CryptoDataResponse) {
+	ctx := context.Background()
+	jsonData, err := json.Marshal(compactSnapshot(data))
+	if err != nil {
+		log.Printf("❌ Failed to marshal snapshot: %v", err)
+		return
+	}
+
+	id := snapshotID(data.Timestamp)
+	cutoff := time.Now().Add(-snapshotRetention).Unix()
+
+	// The snapshot goes in before its index entry, so readers never see an ID without data
+	if err := store.Set(ctx, snapshotKey(id), string(jsonData), snapshotRetention); err != nil {
+		log.Printf("❌ Failed to store snapshot %s: %v", id, err)
+		return
+	}
+	if err := store.ZAdd(ctx, snapshotIndexKey, float64(data.Timestamp.Unix()), id); err != nil {
+		log.Printf("❌ Failed to index snapshot %s: %v", id, err)
+		return
+	}
+	if err := store.ZRemRangeByScore(ctx, snapshotIndexKey, math.Inf(-1), float64(cutoff-1)); err != nil {
+		log.Printf("⚠️  Failed to prune snapshot index: %v", err)
+	}
+
+	log.Printf("✅ Stored snapshot %s (retention %s)", id, snapshotRetention)
+}
+
+// List snapshots between from and to (inclusive), oldest first
+func listSnapshots(from, to time.Time, limit int) ([]SnapshotInfo, error) {
+	ctx := context.Background()
+	ids, err := store.ZRangeByScore(ctx, snapshotIndexKey, float64(from.Unix()), float64(to.Unix()), limit, false)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]SnapshotInfo, 0, len(ids))
+	for _, id := range ids {
+		unix, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{Timestamp: time.Unix(unix, 0).UTC(), ID: id})
+	}
+	return snapshots, nil
+}
+
+// Get a single snapshot by ID
+func getSnapshot(id string) (CryptoDataResponse, bool) {
+	data, ok := loadSnapshot(id)
+	if !ok {
+		return CryptoDataResponse{}, false
+	}
+	return expandSnapshot(data), true
+}
+
+// A snapshot as stored, without expanding it
+func loadSnapshot(id string) (CryptoDataResponse, bool) {
+	data, err := store.Get(context.Background(), snapshotKey(id))
+	if err != nil {
+		return CryptoDataResponse{}, false
+	}
+
+	var result CryptoDataResponse
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		log.Printf("❌ Failed to unmarshal snapshot %s: %v", id, err)
+		return CryptoDataResponse{}, false
+	}
+	return result, true
+}
+
+// Get the most recent snapshot taken at or before t
+func getSnapshotAt(t time.Time) (CryptoDataResponse, bool) {
+	ctx := context.Background()
+	ids, err := store.ZRangeByScore(ctx, snapshotIndexKey, math.Inf(-1), float64(t.Unix()), 1, true)
+	if err != nil || len(ids) == 0 {
+		return CryptoDataResponse{}, false
+	}
+
+	return getSnapshot(ids[0])
+}
+
+// snapshotMetric is one metric as stored in a single snapshot
+type snapshotMetric struct {
+	Timestamp time.Time
+	Loaded    bool        // False when the snapshot expired before it was read
+	Metric    *MetricData // nil when the snapshot doesn't hold the metric
+}
+
+// Snapshots fetched per MGET by getSnapshotMetric
+const snapshotReadBatch = 50
+
+// Load a single metric from each listed snapshot, in the order given. Snapshots
+// are read in batches and only the requested metric is decoded, so memory use
+// doesn't grow with the number of snapshots.
+func getSnapshotMetric(infos []SnapshotInfo, metric string) ([]snapshotMetric, error) {
+	ctx := context.Background()
+	results := make([]snapshotMetric, len(infos))
+
+	for start := 0; start < len(infos); start += snapshotReadBatch {
+		batch := infos[start:min(start+snapshotReadBatch, len(infos))]
+		keys := make([]string, len(batch))
+		for i, info := range batch {
+			keys[i] = snapshotKey(info.ID)
+		}
+
+		values, err := store.MGet(ctx, keys...)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, raw := range values {
+			result := &results[start+i]
+			result.Timestamp = batch[i].Timestamp
+			if raw == "" {
+				continue // expired between ZRANGE and MGET
+			}
+
+			var snapshot struct {
+				Timestamp  time.Time                  `json:"timestamp"`
+				AllMetrics map[string]json.RawMessage `json:"all_metrics"`
+			}
+			if err := json.Unmarshal([]byte(raw), &snapshot); err != nil {
+				log.Printf("❌ Failed to unmarshal snapshot %s: %v", batch[i].ID, err)
+				continue
+			}
+			result.Timestamp = snapshot.Timestamp
+			result.Loaded = true
+
+			if rawMetric, exists := snapshot.AllMetrics[metric]; exists {
+				var metricData MetricData
+				if err := json.Unmarshal(rawMetric, &metricData); err != nil {
+					log.Printf("❌ Failed to unmarshal %s in snapshot %s: %v", metric, batch[i].ID, err)
+					continue
+				}
+				result.Metric = &metricData
+			}
+		}
+	}
+	return results, nil
+}
+
+// parseTimeParam accepts unix seconds, RFC3339, "now", or a relative age such
+// as "90m", "24h" or "7d" (meaning that long before now)
+func parseTimeParam(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "now" {
+		return now, nil
+	}
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	if d, err := parseDurationWithDays(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q: use unix seconds, RFC3339 or a duration like 24h / 7d", value)
+}
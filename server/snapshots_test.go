@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func snapshotRun(at time.Time, symbols ...string) CryptoDataResponse {
+	data := make([]CryptoData, len(symbols))
+	for i, symbol := range symbols {
+		value := float64(100 - 10*i)
+		id := int(symbol[0])<<8 | int(symbol[1]) // Stable per coin across runs
+		data[i] = CryptoData{ID: id, Name: symbol, Symbol: symbol, Sort: "market_cap", RawValue: &value, Rank: i + 1}
+	}
+	return CryptoDataResponse{
+		Timestamp: at.Truncate(time.Second),
+		AllMetrics: map[string]MetricData{
+			"market_cap": {
+				Name:        "Market Cap",
+				Description: sortableMetrics()["market_cap"].Description,
+				Success:     true,
+				DataCount:   len(data),
+				AllData:     data,
+				Top3Preview: data[:min(3, len(data))],
+			},
+		},
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	store = newFailoverStore(nil)
+	now := time.Now()
+
+	previous := snapshotRun(now.Add(-5*time.Minute), "BTC", "ETH", "SOL", "XRP")
+	current := snapshotRun(now, "ETH", "BTC", "XRP", "ADA")
+	applyRankChanges(&current, previous)
+	storeSnapshotInRedis(previous)
+	storeSnapshotInRedis(current)
+
+	got, ok := getSnapshot(snapshotID(current.Timestamp))
+	if !ok {
+		t.Fatal("snapshot not found")
+	}
+	want, _ := json.Marshal(current)
+	gotJSON, _ := json.Marshal(got)
+	if string(gotJSON) != string(want) {
+		t.Errorf("snapshot changed in the round trip:\n got %s\nwant %s", gotJSON, want)
+	}
+	if len(got.AllMetrics["market_cap"].Changes) == 0 {
+		t.Error("rank changes weren't rebuilt")
+	}
+}
+
+func TestSnapshotWithoutPreviousDropsChanges(t *testing.T) {
+	store = newFailoverStore(nil)
+	now := time.Now()
+
+	previous := snapshotRun(now.Add(-5*time.Minute), "BTC", "ETH")
+	current := snapshotRun(now, "ETH", "BTC")
+	applyRankChanges(&current, previous)
+	storeSnapshotInRedis(current) // The previous snapshot has expired
+
+	got, ok := getSnapshot(snapshotID(current.Timestamp))
+	if !ok {
+		t.Fatal("snapshot not found")
+	}
+	if metricData := got.AllMetrics["market_cap"]; metricData.Changes != nil || metricData.ComparedTo != nil {
+		t.Errorf("got changes %v compared to %v, want neither", metricData.Changes, metricData.ComparedTo)
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound is returned by Store lookups for a missing key or field
+var ErrNotFound = errors.New("not found")
+
+// Store is the subset of Redis the server relies on. Values are opaque strings
+// (usually JSON); only plain keys support a TTL.
+type Store interface {
+	Name() string
+
+	Get(ctx context.Context, key string) (string, error)
+	MGet(ctx context.Context, keys ...string) ([]string, error) // "" for missing keys
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+	// Counter that never goes backwards: key is first raised to the integer
+	// in floorKey when that is higher, then incremented
+	IncrFrom(ctx context.Context, key, floorKey string) (int64, error)
+
+	// Lock helpers: act only while key still holds value
+	CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	CompareAndDelete(ctx context.Context, key, value string) (bool, error)
+
+	// Fenced write: set key unless it was already written with a higher
+	// generation (kept under key+":generation")
+	SetIfNewer(ctx context.Context, key, value string, generation int64, ttl time.Duration) (bool, error)
+
+	// Sorted sets; Rev returns highest scores first
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	ZRangeByScore(ctx context.Context, key string, min, max float64, limit int, rev bool) ([]string, error)
+	ZRemRangeByScore(ctx context.Context, key string, min, max float64) error
+
+	// Lists, newest first
+	LPushTrim(ctx context.Context, key string, maxLen int, values ...string) error
+	LRange(ctx context.Context, key string, start, stop int) ([]string, error)
+
+	HSet(ctx context.Context, key, field, value string) error
+	HGet(ctx context.Context, key, field string) (string, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HDel(ctx context.Context, key, field string) (bool, error)
+	HIncrBy(ctx context.Context, key, field string, n int64) (int64, error)
+
+	// Sliding-window rate limit: record a hit unless limit hits already
+	// landed in the last window
+	SlidingWindowAllow(ctx context.Context, key string, limit int, window time.Duration) (WindowResult, error)
+}
+
+// WindowResult is the outcome of a SlidingWindowAllow call
+type WindowResult struct {
+	Allowed    bool
+	Count      int           // Hits in the window, including this one when allowed
+	RetryAfter time.Duration // Until the oldest hit leaves the window, when not allowed
+}
+
+// Active storage. Redis when it's reachable, memory otherwise (see failoverStore).
+var store *failoverStore
+
+// failoverStore sends every call to Redis while it is up and to an in-process
+// store while it is down. A connection error flips it to memory; the reconnect
+// loop flips it back and copies whatever was written in the meantime to Redis.
+type failoverStore struct {
+	redis  *redisStore // nil when REDIS_ENABLED=false
+	memory *memoryStore
+	up     atomic.Bool
+
+	// Calls that go to memory hold it for reading; markUp holds it for
+	// writing while it copies memory to Redis, so no write can land in memory
+	// after the copy and be stranded there
+	switching sync.RWMutex
+
+	// Highest value each counter reached in Redis. An outage keeps counting
+	// from there, so fencing tokens handed out from memory are still newer
+	// than the generations Redis holds when the data is copied back.
+	counters   map[string]int64
+	countersMu sync.Mutex
+}
+
+func newFailoverStore(client *redis.Client) *failoverStore {
+	s := &failoverStore{memory: newMemoryStore(), counters: map[string]int64{}}
+	if client != nil {
+		s.redis = &redisStore{client: client}
+	}
+	return s
+}
+
+func (s *failoverStore) redisAvailable() bool {
+	return s.redis != nil && s.up.Load()
+}
+
+// Redis is configured but down, so calls are served by the memory fallback
+func (s *failoverStore) degraded() bool {
+	return s.redis != nil && !s.up.Load()
+}
+
+func (s *failoverStore) active() Store {
+	if s.redisAvailable() {
+		return s.redis
+	}
+	return s.memory
+}
+
+func (s *failoverStore) Name() string {
+	return s.active().Name()
+}
+
+func (s *failoverStore) markDown(err error) {
+	redisHealth.recordError(err)
+	if s.up.CompareAndSwap(true, false) {
+		log.Printf("⚠️  Redis unavailable, falling back to in-memory storage: %v", err)
+	}
+}
+
+// Redis answered a ping: switch back and hand over anything stored in memory
+func (s *failoverStore) markUp(ctx context.Context) {
+	if s.redis == nil || s.up.Load() {
+		return
+	}
+	s.switching.Lock()
+	defer s.switching.Unlock()
+	if s.up.Load() {
+		return
+	}
+	if copied, err := s.memory.flushTo(ctx, s.redis); err != nil {
+		log.Printf("❌ Failed to copy in-memory data to Redis, staying on memory: %v", err)
+		return
+	} else if copied > 0 {
+		log.Printf("📦 Copied %d in-memory keys to Redis", copied)
+	}
+	s.up.Store(true)
+	log.Printf("✅ Using Redis storage")
+}
+
+// Run fn against the active store, retrying on memory if Redis fails to answer
+func withFailover[T any](s *failoverStore, fn func(Store) (T, error)) (T, error) {
+	if s.redisAvailable() {
+		value, err := fn(s.redis)
+		if err == nil || !isConnectionError(err) {
+			return value, err
+		}
+		s.markDown(err)
+	}
+
+	s.switching.RLock()
+	defer s.switching.RUnlock()
+	return fn(s.active()) // Redis again if markUp finished while this call waited
+}
+
+// Errors that mean Redis can't be reached: dial, read and write failures
+// (client timeouts included), dropped connections and pool timeouts. The
+// caller's own context running out says nothing about Redis.
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false // context errors also satisfy net.Error
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, redis.ErrPoolTimeout)
+}
+
+func (s *failoverStore) Get(ctx context.Context, key string) (string, error) {
+	return withFailover(s, func(b Store) (string, error) { return b.Get(ctx, key) })
+}
+
+func (s *failoverStore) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	return withFailover(s, func(b Store) ([]string, error) { return b.MGet(ctx, keys...) })
+}
+
+func (s *failoverStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	_, err := withFailover(s, func(b Store) (struct{}, error) { return struct{}{}, b.Set(ctx, key, value, ttl) })
+	return err
+}
+
+func (s *failoverStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return withFailover(s, func(b Store) (bool, error) { return b.SetNX(ctx, key, value, ttl) })
+}
+
+func (s *failoverStore) Del(ctx context.Context, keys ...string) error {
+	_, err := withFailover(s, func(b Store) (struct{}, error) { return struct{}{}, b.Del(ctx, keys...) })
+	return err
+}
+
+func (s *failoverStore) IncrFrom(ctx context.Context, key, floorKey string) (int64, error) {
+	return withFailover(s, func(b Store) (int64, error) {
+		if b == Store(s.memory) {
+			s.countersMu.Lock()
+			s.memory.raiseCounter(key, s.counters[key])
+			s.countersMu.Unlock()
+			return b.IncrFrom(ctx, key, floorKey)
+		}
+		n, err := b.IncrFrom(ctx, key, floorKey)
+		if err == nil {
+			s.countersMu.Lock()
+			s.counters[key] = max(s.counters[key], n)
+			s.countersMu.Unlock()
+		}
+		return n, err
+	})
+}
+
+func (s *failoverStore) CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return withFailover(s, func(b Store) (bool, error) { return b.CompareAndExpire(ctx, key, value, ttl) })
+}
+
+func (s *failoverStore) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	return withFailover(s, func(b Store) (bool, error) { return b.CompareAndDelete(ctx, key, value) })
+}
+
+func (s *failoverStore) SetIfNewer(ctx context.Context, key, value string, generation int64, ttl time.Duration) (bool, error) {
+	return withFailover(s, func(b Store) (bool, error) { return b.SetIfNewer(ctx, key, value, generation, ttl) })
+}
+
+func (s *failoverStore) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	_, err := withFailover(s, func(b Store) (struct{}, error) { return struct{}{}, b.ZAdd(ctx, key, score, member) })
+	return err
+}
+
+func (s *failoverStore) ZRangeByScore(ctx context.Context, key string, min, max float64, limit int, rev bool) ([]string, error) {
+	return withFailover(s, func(b Store) ([]string, error) { return b.ZRangeByScore(ctx, key, min, max, limit, rev) })
+}
+
+func (s *failoverStore) ZRemRangeByScore(ctx context.Context, key string, min, max float64) error {
+	_, err := withFailover(s, func(b Store) (struct{}, error) { return struct{}{}, b.ZRemRangeByScore(ctx, key, min, max) })
+	return err
+}
+
+func (s *failoverStore) LPushTrim(ctx context.Context, key string, maxLen int, values ...string) error {
+	_, err := withFailover(s, func(b Store) (struct{}, error) { return struct{}{}, b.LPushTrim(ctx, key, maxLen, values...) })
+	return err
+}
+
+func (s *failoverStore) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	return withFailover(s, func(b Store) ([]string, error) { return b.LRange(ctx, key, start, stop) })
+}
+
+func (s *failoverStore) HSet(ctx context.Context, key, field, value string) error {
+	_, err := withFailover(s, func(b Store) (struct{}, error) { return struct{}{}, b.HSet(ctx, key, field, value) })
+	return err
+}
+
+func (s *failoverStore) HGet(ctx context.Context, key, field string) (string, error) {
+	return withFailover(s, func(b Store) (string, error) { return b.HGet(ctx, key, field) })
+}
+
+func (s *failoverStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return withFailover(s, func(b Store) (map[string]string, error) { return b.HGetAll(ctx, key) })
+}
+
+func (s *failoverStore) HDel(ctx context.Context, key, field string) (bool, error) {
+	return withFailover(s, func(b Store) (bool, error) { return b.HDel(ctx, key, field) })
+}
+
+func (s *failoverStore) HIncrBy(ctx context.Context, key, field string, n int64) (int64, error) {
+	return withFailover(s, func(b Store) (int64, error) { return b.HIncrBy(ctx, key, field, n) })
+}
+
+func (s *failoverStore) SlidingWindowAllow(ctx context.Context, key string, limit int, window time.Duration) (WindowResult, error) {
+	return withFailover(s, func(b Store) (WindowResult, error) { return b.SlidingWindowAllow(ctx, key, limit, window) })
+}
+
+// redisStore is the Store backed by a Redis server
+type redisStore struct {
+	client *redis.Client
+}
+
+func (r *redisStore) Name() string {
+	return "redis"
+}
+
+func notFound(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Score bound in Redis syntax
+func scoreBound(score float64) string {
+	switch {
+	case math.IsInf(score, -1):
+		return "-inf"
+	case math.IsInf(score, 1):
+		return "+inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+func (r *redisStore) Get(ctx context.Context, key string) (string, error) {
+	value, err := r.client.Get(ctx, key).Result()
+	return value, notFound(err)
+}
+
+func (r *redisStore) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i], _ = value.(string)
+	}
+	return result, nil
+}
+
+func (r *redisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (r *redisStore) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (r *redisStore) Del(ctx context.Context, keys ...string) error {
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *redisStore) IncrFrom(ctx context.Context, key, floorKey string) (int64, error) {
+	return incrFromScript.Run(ctx, r.client, []string{key, floorKey}).Int64()
+}
+
+// Key holding the generation of the value last written by SetIfNewer
+func generationKey(key string) string {
+	return key + ":generation"
+}
+
+var (
+	compareAndExpireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	// Hits are members of a sorted set scored by time in milliseconds
+	slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+if count >= limit then
+	local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+	return {0, count, tonumber(oldest[2]) + window - now}
+end
+redis.call("ZADD", KEYS[1], now, ARGV[4])
+redis.call("PEXPIRE", KEYS[1], window)
+return {1, count + 1, 0}`)
+	incrFromScript = redis.NewScript(`
+local n = tonumber(redis.call("GET", KEYS[1]) or "0")
+local floor = tonumber(redis.call("GET", KEYS[2]) or "0")
+if floor > n then
+	n = floor
+end
+n = n + 1
+redis.call("SET", KEYS[1], n)
+return n`)
+	setIfNewerScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[2]) or "0")
+if tonumber(ARGV[2]) < current then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+	redis.call("SET", KEYS[2], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+	redis.call("SET", KEYS[2], ARGV[2])
+end
+return 1`)
+)
+
+func (r *redisStore) CompareAndExpire(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	n, err := compareAndExpireScript.Run(ctx, r.client, []string{key}, value, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (r *redisStore) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	n, err := compareAndDeleteScript.Run(ctx, r.client, []string{key}, value).Int()
+	return n == 1, err
+}
+
+func (r *redisStore) SetIfNewer(ctx context.Context, key, value string, generation int64, ttl time.Duration) (bool, error) {
+	n, err := setIfNewerScript.Run(ctx, r.client, []string{key, generationKey(key)}, value, generation, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (r *redisStore) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	return r.client.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Err()
+}
+
+func (r *redisStore) ZRangeByScore(ctx context.Context, key string, min, max float64, limit int, rev bool) ([]string, error) {
+	by := &redis.ZRangeBy{Min: scoreBound(min), Max: scoreBound(max), Count: int64(limit)}
+	if rev {
+		return r.client.ZRevRangeByScore(ctx, key, by).Result()
+	}
+	return r.client.ZRangeByScore(ctx, key, by).Result()
+}
+
+func (r *redisStore) ZRemRangeByScore(ctx context.Context, key string, min, max float64) error {
+	return r.client.ZRemRangeByScore(ctx, key, scoreBound(min), scoreBound(max)).Err()
+}
+
+func (r *redisStore) LPushTrim(ctx context.Context, key string, maxLen int, values ...string) error {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	pipe := r.client.TxPipeline()
+	pipe.LPush(ctx, key, args...)
+	if maxLen > 0 {
+		pipe.LTrim(ctx, key, 0, int64(maxLen-1))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *redisStore) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	return r.client.LRange(ctx, key, int64(start), int64(stop)).Result()
+}
+
+func (r *redisStore) HSet(ctx context.Context, key, field, value string) error {
+	return r.client.HSet(ctx, key, field, value).Err()
+}
+
+func (r *redisStore) HGet(ctx context.Context, key, field string) (string, error) {
+	value, err := r.client.HGet(ctx, key, field).Result()
+	return value, notFound(err)
+}
+
+func (r *redisStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return r.client.HGetAll(ctx, key).Result()
+}
+
+func (r *redisStore) HDel(ctx context.Context, key, field string) (bool, error) {
+	removed, err := r.client.HDel(ctx, key, field).Result()
+	return removed > 0, err
+}
+
+func (r *redisStore) HIncrBy(ctx context.Context, key, field string, n int64) (int64, error) {
+	return r.client.HIncrBy(ctx, key, field, n).Result()
+}
+
+func (r *redisStore) SlidingWindowAllow(ctx context.Context, key string, limit int, window time.Duration) (WindowResult, error) {
+	now := time.Now().UnixMilli()
+	member := strconv.FormatInt(now, 10) + "-" + randomHex(4)
+	values, err := slidingWindowScript.Run(ctx, r.client, []string{key}, now, window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil {
+		return WindowResult{}, err
+	}
+	if len(values) != 3 {
+		return WindowResult{}, fmt.Errorf("sliding window %s: unexpected reply %v", key, values)
+	}
+	return WindowResult{
+		Allowed:    values[0] == 1,
+		Count:      int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
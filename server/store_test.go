@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// A failover store on a miniredis server that starts out connected
+func newTestFailoverStore(t *testing.T) (*failoverStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{
+		Addr:        server.Addr(),
+		MaxRetries:  -1,
+		DialTimeout: 200 * time.Millisecond,
+	})
+	t.Cleanup(func() { client.Close() })
+
+	s := newFailoverStore(client)
+	s.up.Store(true)
+	return s, server
+}
+
+func TestFailoverStoreSwitchesToMemoryAndBack(t *testing.T) {
+	s, server := newTestFailoverStore(t)
+	ctx := context.Background()
+
+	if err := s.Set(ctx, "before", "redis", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := server.Get("before"); got != "redis" {
+		t.Fatalf("Redis holds %q, want the write made while up", got)
+	}
+
+	server.Close()
+	if err := s.Set(ctx, "during", "memory", time.Hour); err != nil {
+		t.Fatalf("write during the outage failed: %v", err)
+	}
+	if s.redisAvailable() || s.Name() != "memory" {
+		t.Fatal("store didn't switch to memory after a connection error")
+	}
+	if err := s.LPushTrim(ctx, "list", 10, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HIncrBy(ctx, "hash", "count", 2); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, "during"); err != nil || got != "memory" {
+		t.Fatalf("read during the outage: %q, %v", got, err)
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	s.markUp(ctx)
+	if !s.redisAvailable() {
+		t.Fatal("store didn't switch back to Redis")
+	}
+
+	if got, _ := server.Get("during"); got != "memory" {
+		t.Errorf("Redis holds %q for the outage write, want it copied over", got)
+	}
+	if ttl := server.TTL("during"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("copied key TTL %s, want its remaining TTL", ttl)
+	}
+	if list, _ := server.List("list"); len(list) != 2 || list[0] != "b" {
+		t.Errorf("Redis list %v, want [b a]", list)
+	}
+	if count := server.HGet("hash", "count"); count != "2" {
+		t.Errorf("Redis counter %q, want 2", count)
+	}
+	if _, err := s.memory.Get(ctx, "during"); !errors.Is(err, ErrNotFound) {
+		t.Error("memory wasn't cleared after the flush")
+	}
+}
+
+func TestCallerDeadlineDoesNotFailOver(t *testing.T) {
+	s, _ := newTestFailoverStore(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	if _, err := s.Get(ctx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the caller's deadline", err)
+	}
+	if !s.redisAvailable() {
+		t.Error("an expired caller context switched storage to memory")
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, true}, // Client read timeout
+		{fmt.Errorf("wrapped: %w", io.EOF), true},
+		{redis.ErrPoolTimeout, true},
+		{redis.ErrClosed, true},
+		{context.DeadlineExceeded, false},
+		{fmt.Errorf("wrapped: %w", context.Canceled), false},
+		{redis.Nil, false},
+		{errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), false},
+	}
+	for _, tt := range tests {
+		if got := isConnectionError(tt.err); got != tt.want {
+			t.Errorf("isConnectionError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFailoverStoreKeepsWritesMadeDuringTheSwitch(t *testing.T) {
+	s, server := newTestFailoverStore(t)
+	ctx := context.Background()
+
+	server.Close()
+	s.markDown(errors.New("test outage"))
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Enough outage data that the copy takes a while
+	for i := 0; i < 500; i++ {
+		if err := s.HSet(ctx, fmt.Sprintf("outage:%d", i), "field", "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Writers keep going while the reconnect copies memory to Redis
+	const writers, writes = 8, 50
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < writes; i++ {
+				if err := s.Set(ctx, fmt.Sprintf("key:%d:%d", w, i), "v", 0); err != nil {
+					t.Errorf("write failed: %v", err)
+					return
+				}
+				if err := s.LPushTrim(ctx, "events", 0, "e"); err != nil {
+					t.Errorf("push failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	close(start)
+	s.markUp(ctx)
+	wg.Wait()
+
+	if !s.redisAvailable() {
+		t.Fatal("store didn't switch back to Redis")
+	}
+	for w := 0; w < writers; w++ {
+		for i := 0; i < writes; i++ {
+			key := fmt.Sprintf("key:%d:%d", w, i)
+			if !server.Exists(key) {
+				t.Fatalf("%s was written during the switch but never reached Redis", key)
+			}
+		}
+	}
+	if events, _ := server.List("events"); len(events) != writers*writes {
+		t.Errorf("Redis has %d events, want %d", len(events), writers*writes)
+	}
+}
+
+// The memory store and Redis, for tests both have to pass
+func testBackends(t *testing.T) map[string]Store {
+	t.Helper()
+	redisBacked, _ := newTestFailoverStore(t)
+	return map[string]Store{"memory": newMemoryStore(), "redis": redisBacked.redis}
+}
+
+func TestSetIfNewer(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range testBackends(t) {
+		steps := []struct {
+			value      string
+			generation int64
+			stored     bool
+		}{
+			{"first", 5, true},
+			{"older", 4, false},
+			{"same", 5, true}, // A run rewriting its own data
+			{"newer", 9, true},
+			{"stale", 6, false},
+		}
+		for _, step := range steps {
+			stored, err := s.SetIfNewer(ctx, "latest", step.value, step.generation, time.Hour)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if stored != step.stored {
+				t.Errorf("%s: generation %d stored %v, want %v", name, step.generation, stored, step.stored)
+			}
+		}
+		if got, _ := s.Get(ctx, "latest"); got != "newer" {
+			t.Errorf("%s: holds %q, want the generation 9 value", name, got)
+		}
+		if got, _ := s.Get(ctx, generationKey("latest")); got != "9" {
+			t.Errorf("%s: generation %q, want 9", name, got)
+		}
+	}
+}
+
+func TestIncrFrom(t *testing.T) {
+	ctx := context.Background()
+	for name, s := range testBackends(t) {
+		if n, err := s.IncrFrom(ctx, "fence", "floor"); err != nil || n != 1 {
+			t.Errorf("%s: first token %d, %v, want 1", name, n, err)
+		}
+		// A floor above the counter (the counter was lost) wins
+		if err := s.Set(ctx, "floor", "40", 0); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := s.IncrFrom(ctx, "fence", "floor"); n != 41 {
+			t.Errorf("%s: token %d, want 41 above the floor", name, n)
+		}
+		if n, _ := s.IncrFrom(ctx, "fence", "floor"); n != 42 {
+			t.Errorf("%s: token %d, want 42", name, n)
+		}
+	}
+}
+
+func TestFailoverStoreGenerationsSurviveAnOutage(t *testing.T) {
+	s, server := newTestFailoverStore(t)
+	ctx := context.Background()
+
+	server.Set(generationKey("latest"), "41")
+	token, err := s.IncrFrom(ctx, "fence", generationKey("latest"))
+	if err != nil || token != 42 {
+		t.Fatalf("token %d, %v, want 42", token, err)
+	}
+	if _, err := s.SetIfNewer(ctx, "latest", "before", token, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	s.markDown(errors.New("test outage"))
+	token, err = s.IncrFrom(ctx, "fence", generationKey("latest"))
+	if err != nil || token != 43 {
+		t.Fatalf("outage token %d, %v, want 43 to carry on from Redis", token, err)
+	}
+	if _, err := s.SetIfNewer(ctx, "latest", "during", token, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	s.markUp(ctx)
+	if got, _ := server.Get("latest"); got != "during" {
+		t.Errorf("Redis holds %q, want the outage run's data", got)
+	}
+	if token, _ := s.IncrFrom(ctx, "fence", generationKey("latest")); token != 44 {
+		t.Errorf("token after the outage %d, want 44", token)
+	}
+}
+
+func TestFailoverStoreFlushKeepsListCaps(t *testing.T) {
+	s, server := newTestFailoverStore(t)
+	ctx := context.Background()
+
+	if err := s.LPushTrim(ctx, "recent", 3, "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	s.markDown(errors.New("test outage"))
+	if err := s.LPushTrim(ctx, "recent", 3, "d", "e"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	s.markUp(ctx)
+
+	list, _ := server.List("recent")
+	if len(list) != 3 || list[0] != "e" || list[2] != "c" {
+		t.Errorf("Redis list %v, want [e d c]", list)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// Every instance subscribes to this channel, so a write on any instance
+// reaches clients connected to all of them
+const updatesChannel = "crypto:updates"
+
+const (
+	subscriberBuffer  = 8
+	streamHeartbeat   = 25 * time.Second
+	streamModeFull    = "full"
+	streamModeDiff    = "diff"
+	streamEventUpdate = "update"
+	streamEventDiff   = "diff"
+)
+
+// StreamUpdate is one stored run plus the metrics whose ranking changed since
+// the run this instance saw before it
+type StreamUpdate struct {
+	Data           CryptoDataResponse
+	Previous       *CryptoDataResponse // nil for the first run this instance sees
+	ChangedMetrics []string
+}
+
+// Payload for diff-mode clients: only the metrics that changed
+type StreamDiff struct {
+	Timestamp      time.Time             `json:"timestamp"`
+	ChangedMetrics []string              `json:"changed_metrics"`
+	Metrics        map[string]MetricData `json:"metrics"`
+	FetchStats     FetchStats            `json:"fetch_stats"`
+}
+
+func (u StreamUpdate) diff() StreamDiff {
+	metrics := make(map[string]MetricData, len(u.ChangedMetrics))
+	for _, sortType := range u.ChangedMetrics {
+		metrics[sortType] = u.Data.AllMetrics[sortType]
+	}
+	return StreamDiff{
+		Timestamp:      u.Data.Timestamp,
+		ChangedMetrics: u.ChangedMetrics,
+		Metrics:        metrics,
+		FetchStats:     u.Data.FetchStats,
+	}
+}
+
+type hubSubscriber struct {
+	updates chan StreamUpdate
+	dropped int
+}
+
+// updateHub fans stored runs out to the clients connected to this instance
+type updateHub struct {
+	mu          sync.Mutex
+	subscribers map[*hubSubscriber]struct{}
+	last        *CryptoDataResponse
+}
+
+var hub = &updateHub{subscribers: make(map[*hubSubscriber]struct{})}
+
+func (h *updateHub) subscribe() *hubSubscriber {
+	s := &hubSubscriber{updates: make(chan StreamUpdate, subscriberBuffer)}
+	h.mu.Lock()
+	h.subscribers[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *updateHub) unsubscribe(s *hubSubscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, s)
+	h.mu.Unlock()
+}
+
+func (h *updateHub) clientCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Deliver a run to every subscriber without blocking on slow ones
+func (h *updateHub) broadcast(data CryptoDataResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.last != nil && !data.Timestamp.After(h.last.Timestamp) {
+		return // Duplicate or out-of-order publish
+	}
+
+	update := StreamUpdate{Data: data, Previous: h.last, ChangedMetrics: changedMetrics(h.last, data)}
+	h.last = &data
+
+	for s := range h.subscribers {
+		select {
+		case s.updates <- update:
+		default:
+			s.dropped++
+		}
+	}
+	log.Printf("📡 Broadcast update to %d clients (%d metrics changed)", len(h.subscribers), len(update.ChangedMetrics))
+}
+
+// Metrics whose ranked coins or values differ between two runs
+func changedMetrics(previous *CryptoDataResponse, current CryptoDataResponse) []string {
+	changed := []string{}
+	for sortType, metricData := range current.AllMetrics {
+		if previous == nil {
+			changed = append(changed, sortType)
+			continue
+		}
+		before, exists := previous.AllMetrics[sortType]
+		if !exists || before.Success != metricData.Success || !sameRanking(before.AllData, metricData.AllData) {
+			changed = append(changed, sortType)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func sameRanking(a, b []CryptoData) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Symbol != b[i].Symbol || a[i].Value != b[i].Value || !reflect.DeepEqual(a[i].RawValue, b[i].RawValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// Events carry the run's timestamp as their ID, so the Last-Event-ID of a
+// reconnecting client says which run it already has
+func streamEventID(data CryptoDataResponse) string {
+	return strconv.FormatInt(data.Timestamp.UnixMilli(), 10)
+}
+
+func writeStreamEvent(c *gin.Context, event string, data CryptoDataResponse, payload any) {
+	c.Render(-1, sse.Event{Id: streamEventID(data), Event: event, Data: payload})
+}
+
+// Announce a newly stored run. With Redis this goes through pub/sub so every
+// instance (including this one) hears it; without Redis it's local only.
+func publishUpdate(data CryptoDataResponse, jsonData []byte) {
+	if !store.redisAvailable() {
+		hub.broadcast(data)
+		return
+	}
+
+	if err := rdb.Publish(context.Background(), updatesChannel, jsonData).Err(); err != nil {
+		log.Printf("❌ Failed to publish update, broadcasting locally: %v", err)
+		hub.broadcast(data)
+	}
+}
+
+// Listen for runs stored by any instance and hand them to the local hub
+func startUpdateSubscriber() {
+	if latest, exists := getLatestDataFromRedis(); exists {
+		hub.mu.Lock()
+		hub.last = &latest
+		hub.mu.Unlock()
+	}
+
+	if rdb == nil {
+		log.Printf("⚠️  Redis disabled, live updates limited to this instance")
+		return
+	}
+
+	// The subscription reconnects on its own if Redis drops or isn't up yet
+	pubsub := rdb.Subscribe(context.Background(), updatesChannel)
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			var data CryptoDataResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &data); err != nil {
+				log.Printf("❌ Failed to unmarshal update: %v", err)
+				continue
+			}
+			hub.broadcast(data)
+		}
+	}()
+	log.Printf("✅ Subscribed to %s for live updates", updatesChannel)
+}
+
+// GET /api/crypto/stream?mode=full|diff
+// Sends the current data as an "update" event on connect, then either the
+// full CryptoDataResponse ("update") or only changed metrics ("diff") per run.
+// A client reconnecting with the Last-Event-ID of the current run skips the
+// initial "update"; one that missed runs gets it in full.
+func streamCryptoData(c *gin.Context) {
+	mode := c.DefaultQuery("mode", streamModeFull)
+	if mode != streamModeFull && mode != streamModeDiff {
+		c.JSON(400, gin.H{"error": "Mode must be 'full' or 'diff'"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	subscriber := hub.subscribe()
+	defer hub.unsubscribe(subscriber)
+
+	if data, exists := getLatestDataFromRedis(); exists && c.GetHeader("Last-Event-ID") != streamEventID(data) {
+		writeStreamEvent(c, streamEventUpdate, data, data)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			c.SSEvent("ping", gin.H{"time": time.Now().UTC()})
+		case update := <-subscriber.updates:
+			if mode == streamModeDiff {
+				if len(update.ChangedMetrics) == 0 {
+					continue
+				}
+				writeStreamEvent(c, streamEventDiff, update.Data, update.diff())
+			} else {
+				writeStreamEvent(c, streamEventUpdate, update.Data, update.Data)
+			}
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func streamRun(at time.Time, prices map[string]string) CryptoDataResponse {
+	data := CryptoDataResponse{Timestamp: at, AllMetrics: map[string]MetricData{}}
+	for sortType, value := range prices {
+		data.AllMetrics[sortType] = MetricData{Success: true, AllData: []CryptoData{{ID: 1, Symbol: "BTC", Value: value, Rank: 1}}}
+	}
+	return data
+}
+
+func newTestHub() *updateHub {
+	return &updateHub{subscribers: make(map[*hubSubscriber]struct{})}
+}
+
+func TestHubBroadcastsToEverySubscriber(t *testing.T) {
+	h := newTestHub()
+	subscribers := []*hubSubscriber{h.subscribe(), h.subscribe(), h.subscribe()}
+
+	run := streamRun(time.Now(), map[string]string{"price": "$1"})
+	h.broadcast(run)
+	h.broadcast(run) // Duplicate publish from another instance
+
+	for i, s := range subscribers {
+		if got := len(s.updates); got != 1 {
+			t.Errorf("subscriber %d: %d updates queued, want 1", i, got)
+			continue
+		}
+		if update := <-s.updates; !update.Data.Timestamp.Equal(run.Timestamp) || update.Previous != nil {
+			t.Errorf("subscriber %d: got %+v, want the first run", i, update)
+		}
+	}
+
+	h.unsubscribe(subscribers[0])
+	if h.clientCount() != 2 {
+		t.Errorf("got %d clients after unsubscribe, want 2", h.clientCount())
+	}
+}
+
+func TestHubDropsUpdatesForSlowSubscribers(t *testing.T) {
+	h := newTestHub()
+	slow := h.subscribe()
+	fast := h.subscribe()
+
+	start := time.Now()
+	runs := subscriberBuffer + 3
+	for i := 0; i < runs; i++ {
+		h.broadcast(streamRun(start.Add(time.Duration(i)*time.Minute), map[string]string{"price": "$1"}))
+		<-fast.updates
+	}
+
+	if len(slow.updates) != subscriberBuffer || slow.dropped != 3 {
+		t.Errorf("slow subscriber: %d queued, %d dropped; want %d queued, 3 dropped", len(slow.updates), slow.dropped, subscriberBuffer)
+	}
+	if fast.dropped != 0 {
+		t.Errorf("fast subscriber dropped %d updates", fast.dropped)
+	}
+}
+
+func TestDiffIncludesOnlyChangedMetrics(t *testing.T) {
+	h := newTestHub()
+	s := h.subscribe()
+	start := time.Now()
+
+	h.broadcast(streamRun(start, map[string]string{"price": "$1", "market_cap": "$5B"}))
+	if update := <-s.updates; strings.Join(update.ChangedMetrics, ",") != "market_cap,price" {
+		t.Errorf("first run: changed %v, want every metric", update.ChangedMetrics)
+	}
+
+	h.broadcast(streamRun(start.Add(time.Minute), map[string]string{"price": "$2", "market_cap": "$5B"}))
+	update := <-s.updates
+	if strings.Join(update.ChangedMetrics, ",") != "price" {
+		t.Fatalf("second run: changed %v, want [price]", update.ChangedMetrics)
+	}
+	diff := update.diff()
+	if _, exists := diff.Metrics["market_cap"]; exists || len(diff.Metrics) != 1 || diff.Metrics["price"].AllData[0].Value != "$2" {
+		t.Errorf("diff metrics %+v, want only the new price", diff.Metrics)
+	}
+
+	h.broadcast(streamRun(start.Add(2*time.Minute), map[string]string{"price": "$2", "market_cap": "$5B"}))
+	if update := <-s.updates; len(update.ChangedMetrics) != 0 {
+		t.Errorf("unchanged run: changed %v, want none", update.ChangedMetrics)
+	}
+}
+
+type streamEvent struct {
+	id, event string
+}
+
+// Read the next non-ping event from an SSE stream
+func readStreamEvent(t *testing.T, reader *bufio.Reader) streamEvent {
+	t.Helper()
+	var event streamEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id:"):
+			event.id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			event.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case line == "" && event.event != "":
+			if event.event != "ping" {
+				return event
+			}
+			event = streamEvent{}
+		}
+	}
+}
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store = newFailoverStore(nil)
+	defer func(h *updateHub) { hub = h }(hub)
+	hub = newTestHub()
+
+	r := gin.New()
+	r.GET("/stream", streamCryptoData)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close) // After the clients below disconnect
+
+	first := streamRun(time.Now().Add(-time.Minute), map[string]string{"price": "$1"})
+	if !storeLatestDataInRedis(first) {
+		t.Fatal("failed to store latest data")
+	}
+
+	connect := func(lastEventID string) *bufio.Reader {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return bufio.NewReader(resp.Body)
+	}
+
+	// A new client gets the current run, tagged with its ID
+	event := readStreamEvent(t, connect(""))
+	if event.event != streamEventUpdate || event.id != streamEventID(first) {
+		t.Fatalf("new client: got %+v, want an update with ID %s", event, streamEventID(first))
+	}
+
+	// A client that already has it waits for the next run
+	resumed := connect(event.id)
+	stale := connect("1")
+	second := streamRun(time.Now(), map[string]string{"price": "$2"})
+	if !storeLatestDataInRedis(second) {
+		t.Fatal("failed to store latest data")
+	}
+	if event := readStreamEvent(t, resumed); event.id != streamEventID(second) {
+		t.Errorf("resumed client: got %+v first, want the next run %s", event, streamEventID(second))
+	}
+
+	// A client that missed runs gets the current one on connect
+	if event := readStreamEvent(t, stale); event.event != streamEventUpdate || event.id != streamEventID(first) {
+		t.Errorf("stale client: got %+v first, want the run it missed %s", event, streamEventID(first))
+	}
+}
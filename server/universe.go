@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Fetch modes (FETCH_MODE). "per-metric" asks the provider for each ranking;
+// "universe" fetches one broad coin list and ranks every metric locally, so
+// all rankings come from the same point in time.
+const (
+	FetchModePerMetric = "per-metric"
+	FetchModeUniverse  = "universe"
+)
+
+// The universe is the top coins by market cap
+const universeSort = "market_cap"
+
+var (
+	fetchMode        = FetchModePerMetric
+	universeSize     = 1000 // UNIVERSE_SIZE
+	universePageSize = 500  // UNIVERSE_PAGE_SIZE
+)
+
+// PagedProvider is implemented by providers that can page through a ranking.
+// Providers without it are asked for the whole universe in one call.
+type PagedProvider interface {
+	ListCoinsPage(ctx context.Context, sort string, page, pageSize int) ([]LunarCrushCoin, error)
+}
+
+func initFetchMode() {
+	if mode := os.Getenv("FETCH_MODE"); mode != "" {
+		if mode != FetchModePerMetric && mode != FetchModeUniverse {
+			log.Fatalf("Unknown FETCH_MODE %q (use %s or %s)", mode, FetchModePerMetric, FetchModeUniverse)
+		}
+		fetchMode = mode
+	}
+	universeSize = intFromEnv("UNIVERSE_SIZE", universeSize)
+	universePageSize = intFromEnv("UNIVERSE_PAGE_SIZE", universePageSize)
+
+	if fetchMode == FetchModeUniverse {
+		log.Printf("✅ Fetch mode: universe (top %d coins, pages of %d)", universeSize, universePageSize)
+	} else {
+		log.Printf("✅ Fetch mode: per-metric")
+	}
+}
+
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("⚠️  Invalid %s=%q, using %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// Fetch the coin universe, page by page when the provider supports it
+func fetchUniverse(ctx context.Context, provider Provider, size int) ([]LunarCrushCoin, error) {
+	paged, ok := provider.(PagedProvider)
+	if !ok {
+		return provider.ListCoins(ctx, universeSort, size)
+	}
+
+	// Every page has the same size, since the provider offsets by page*pageSize;
+	// the last one is trimmed instead
+	coins := make([]LunarCrushCoin, 0, size)
+	for page := 0; len(coins) < size; page++ {
+		batch, err := paged.ListCoinsPage(ctx, universeSort, page, universePageSize)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", page, err)
+		}
+		coins = append(coins, batch...)
+		if len(batch) < universePageSize {
+			break // Last page
+		}
+	}
+	if len(coins) > size {
+		coins = coins[:size]
+	}
+	return coins, nil
+}
+
+// Rank coins by a metric's field. Rank-unit metrics sort ascending (1 is best)
+// and treat 0 as unranked; everything else sorts descending. Coins without
+// the field are left out.
+func rankCoins(coins []LunarCrushCoin, config MetricConfig, limit int) []LunarCrushCoin {
+	type ranked struct {
+		coin  LunarCrushCoin
+		value float64
+	}
+
+	ascending := config.Unit == UnitRank
+	candidates := make([]ranked, 0, len(coins))
+	for _, coin := range coins {
+		value, ok := coin.fieldValue(config.Field)
+		if !ok || (ascending && value <= 0) {
+			continue
+		}
+		candidates = append(candidates, ranked{coin: coin, value: value})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if ascending {
+			return candidates[i].value < candidates[j].value
+		}
+		return candidates[i].value > candidates[j].value
+	})
+
+	if limit > 0 && limit < len(candidates) {
+		candidates = candidates[:limit]
+	}
+	result := make([]LunarCrushCoin, len(candidates))
+	for i, candidate := range candidates {
+		result[i] = candidate.coin
+	}
+	return result
+}
+
+// Fetch the universe once and build every metric's ranking from it. The
+// universe itself is returned too.
+func fetchMetricsFromUniverse(ctx context.Context, provider Provider, opts PipelineOptions) (map[string]MetricData, []LunarCrushCoin) {
+	startTime := time.Now()
+	log.Printf("🌐 Fetching coin universe (top %d) from %s", universeSize, provider.Name())
+
+	coins, err := fetchUniverse(ctx, provider, universeSize)
+	fetchTime := time.Since(startTime).Milliseconds()
+	if err == nil {
+		log.Printf("✅ Universe fetched: %d coins in %dms", len(coins), fetchTime)
+	}
+
+	registry := sortableMetrics()
+	results := make(map[string]MetricData, len(opts.Metrics))
+	for _, sortType := range opts.Metrics {
+		config, exists := registry[sortType]
+		if !exists {
+			results[sortType] = unknownMetricData(sortType)
+			continue
+		}
+
+		var ranked []LunarCrushCoin
+		if err == nil {
+			ranked = rankCoins(coins, config, opts.fetchLimit(config))
+		}
+		result := metricDataFromCoins(sortType, config, ranked, err)
+		result.FetchTimeMs = fetchTime
+		results[sortType] = result
+	}
+	return results, coins
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func coinWithFields(symbol string, fields map[string]float64) LunarCrushCoin {
+	return LunarCrushCoin{Symbol: symbol, Name: symbol, Fields: fields}
+}
+
+func coinSymbols(coins []LunarCrushCoin) []string {
+	out := make([]string, len(coins))
+	for i, coin := range coins {
+		out[i] = coin.Symbol
+	}
+	return out
+}
+
+func TestRankCoins(t *testing.T) {
+	coins := []LunarCrushCoin{
+		coinWithFields("BTC", map[string]float64{"volume_24h": 30, "alt_rank": 7}),
+		coinWithFields("ETH", map[string]float64{"volume_24h": 50, "alt_rank": 2}),
+		coinWithFields("SOL", map[string]float64{"alt_rank": 0}), // No volume, unranked
+		coinWithFields("DOGE", map[string]float64{"volume_24h": 30, "alt_rank": 1}),
+	}
+
+	tests := []struct {
+		metric string
+		limit  int
+		want   []string
+	}{
+		// Descending, ties keep universe order, coins without the field are left out
+		{"volume_24h", 0, []string{"ETH", "BTC", "DOGE"}},
+		{"volume_24h", 2, []string{"ETH", "BTC"}},
+		// Rank units sort ascending and skip 0
+		{"alt_rank", 0, []string{"DOGE", "ETH", "BTC"}},
+	}
+	for _, tt := range tests {
+		got := coinSymbols(rankCoins(coins, defaultSortableMetrics[tt.metric], tt.limit))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s limit %d: got %v, want %v", tt.metric, tt.limit, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s limit %d: got %v, want %v", tt.metric, tt.limit, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// pagedProvider serves a ranking of n coins and records the offset of every page it's asked for
+type pagedProvider struct {
+	n       int
+	offsets []int
+}
+
+func (p *pagedProvider) Name() string { return "paged" }
+
+func (p *pagedProvider) ListCoins(ctx context.Context, sort string, limit int) ([]LunarCrushCoin, error) {
+	return p.ListCoinsPage(ctx, sort, 0, limit)
+}
+
+func (p *pagedProvider) ListCoinsPage(ctx context.Context, sort string, page, pageSize int) ([]LunarCrushCoin, error) {
+	offset := page * pageSize
+	p.offsets = append(p.offsets, offset)
+	var coins []LunarCrushCoin
+	for id := offset + 1; id <= min(offset+pageSize, p.n); id++ {
+		coins = append(coins, LunarCrushCoin{ID: id})
+	}
+	return coins, nil
+}
+
+func TestFetchUniversePages(t *testing.T) {
+	defer func(pageSize int) { universePageSize = pageSize }(universePageSize)
+	universePageSize = 3
+
+	tests := []struct {
+		available, size int
+		wantOffsets     []int
+		wantCoins       int
+	}{
+		{available: 20, size: 7, wantOffsets: []int{0, 3, 6}, wantCoins: 7}, // Last page trimmed
+		{available: 20, size: 6, wantOffsets: []int{0, 3}, wantCoins: 6},
+		{available: 5, size: 7, wantOffsets: []int{0, 3}, wantCoins: 5}, // Ranking runs out
+	}
+	for _, tt := range tests {
+		provider := &pagedProvider{n: tt.available}
+		coins, err := fetchUniverse(context.Background(), provider, tt.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(provider.offsets) != fmt.Sprint(tt.wantOffsets) {
+			t.Errorf("size %d of %d: offsets %v, want %v", tt.size, tt.available, provider.offsets, tt.wantOffsets)
+		}
+		if len(coins) != tt.wantCoins {
+			t.Errorf("size %d of %d: got %d coins, want %d", tt.size, tt.available, len(coins), tt.wantCoins)
+		}
+		for i, coin := range coins {
+			if coin.ID != i+1 {
+				t.Errorf("size %d of %d: coin %d has ID %d, want %d", tt.size, tt.available, i, coin.ID, i+1)
+				break
+			}
+		}
+	}
+}
+
+func TestFetchMetricsFromUniverse(t *testing.T) {
+	provider := newFixtureProvider("testdata/fixtures")
+
+	results, _ := fetchMetricsFromUniverse(context.Background(), provider, PipelineOptions{Metrics: []string{"price", "market_cap", "nope"}, Limit: 3, DryRun: true})
+	for _, sortType := range []string{"price", "market_cap"} {
+		metricData := results[sortType]
+		if !metricData.Success || metricData.DataCount != 3 {
+			t.Errorf("%s: success %v with %d coins, want 3 coins", sortType, metricData.Success, metricData.DataCount)
+		}
+		for i, crypto := range metricData.AllData {
+			if crypto.Rank != i+1 || crypto.Sort != sortType {
+				t.Errorf("%s entry %d: rank %d sort %q", sortType, i, crypto.Rank, crypto.Sort)
+			}
+		}
+	}
+	if results["nope"].Success {
+		t.Error("unknown metric reported success")
+	}
+}
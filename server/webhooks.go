@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/inngest/inngestgo"
+	"github.com/inngest/inngestgo/step"
+)
+
+// Webhook event types
+const (
+	WebhookEventDataRefreshed = "data-refreshed"
+	WebhookEventMetricFailed  = "metric-failed"
+	WebhookEventAlertFired    = "alert-fired"
+)
+
+var allWebhookEvents = []string{WebhookEventDataRefreshed, WebhookEventMetricFailed, WebhookEventAlertFired}
+
+const (
+	webhooksKey            = "crypto:webhooks"
+	webhookDeliveryPrefix  = "crypto:webhooks:deliveries:"
+	webhookDeliveryLogMax  = 100
+	webhookDeliverEvent    = "crypto/webhook.deliver"
+	webhookDeliveryRetries = 5
+)
+
+// Deliveries dial through publicOnlyDialer, so a hostname that resolves (or
+// later re-resolves) to an internal address is refused at connect time too
+var webhookHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         publicOnlyDialer().DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// Loopback, link-local, private and other non-routable destinations
+func blockedWebhookIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+func publicOnlyDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedWebhookIP(ip) {
+				return fmt.Errorf("webhook destination %s is not a public address", host)
+			}
+			return nil
+		},
+	}
+}
+
+// Webhook is a registered endpoint. Secret is only returned when it's created.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (w Webhook) subscribedTo(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookJob is one payload queued for one endpoint (the crypto/webhook.deliver event data)
+type WebhookJob struct {
+	WebhookID  string          `json:"webhook_id"`
+	DeliveryID string          `json:"delivery_id"`
+	Event      string          `json:"event"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// WebhookDelivery is one delivery attempt in the delivery log
+type WebhookDelivery struct {
+	DeliveryID string    `json:"delivery_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	At         time.Time `json:"at"`
+}
+
+// Envelope sent to every endpoint
+type webhookEnvelope struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
+
+// Signature over "<timestamp>.<body>" so receivers can reject replays
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func validateWebhook(w *Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if err := checkWebhookHost(u.Hostname()); err != nil {
+		return err
+	}
+
+	if len(w.Events) == 0 {
+		w.Events = allWebhookEvents
+	}
+	for _, event := range w.Events {
+		valid := false
+		for _, known := range allWebhookEvents {
+			if event == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// Reject destinations inside our network: literal internal IPs, localhost and
+// hostnames that resolve to an internal address
+func checkWebhookHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("url must not point at localhost")
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("url host %q does not resolve", host)
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if blockedWebhookIP(ip) {
+			return fmt.Errorf("url must point at a public address, %s is %s", host, ip)
+		}
+	}
+	return nil
+}
+
+func registerWebhook(w Webhook) (Webhook, error) {
+	if err := validateWebhook(&w); err != nil {
+		return Webhook{}, err
+	}
+
+	w.ID = "wh_" + randomHex(8)
+	if w.Secret == "" {
+		w.Secret = randomHex(32)
+	}
+	w.CreatedAt = time.Now().UTC()
+
+	raw, err := json.Marshal(w)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := store.HSet(context.Background(), webhooksKey, w.ID, string(raw)); err != nil {
+		return Webhook{}, err
+	}
+
+	log.Printf("✅ Registered webhook %s → %s %v", w.ID, w.URL, w.Events)
+	return w, nil
+}
+
+func deleteWebhook(id string) (bool, error) {
+	ctx := context.Background()
+	removed, err := store.HDel(ctx, webhooksKey, id)
+	if err != nil {
+		return false, err
+	}
+	store.Del(ctx, webhookDeliveryPrefix+id)
+	return removed, nil
+}
+
+func getWebhook(id string) (Webhook, bool) {
+	raw, err := store.HGet(context.Background(), webhooksKey, id)
+	if err != nil {
+		return Webhook{}, false
+	}
+
+	var w Webhook
+	if err := json.Unmarshal([]byte(raw), &w); err != nil {
+		log.Printf("❌ Failed to unmarshal webhook %s: %v", id, err)
+		return Webhook{}, false
+	}
+	return w, true
+}
+
+// All registered webhooks, secrets included (callers strip them for display)
+func listWebhooks() ([]Webhook, error) {
+	values, err := store.HGetAll(context.Background(), webhooksKey)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]Webhook, 0, len(values))
+	for id, raw := range values {
+		var w Webhook
+		if err := json.Unmarshal([]byte(raw), &w); err != nil {
+			log.Printf("❌ Failed to unmarshal webhook %s: %v", id, err)
+			continue
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, nil
+}
+
+func recordWebhookDelivery(webhookID string, delivery WebhookDelivery) {
+	raw, err := json.Marshal(delivery)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	key := webhookDeliveryPrefix + webhookID
+	if err := store.LPushTrim(ctx, key, webhookDeliveryLogMax, string(raw)); err != nil {
+		log.Printf("❌ Failed to record webhook delivery: %v", err)
+	}
+}
+
+// Delivery log for one webhook, newest first
+func getWebhookDeliveries(webhookID string, limit int) ([]WebhookDelivery, error) {
+	values, err := store.LRange(context.Background(), webhookDeliveryPrefix+webhookID, 0, limit-1)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(values))
+	for _, value := range values {
+		var delivery WebhookDelivery
+		if err := json.Unmarshal([]byte(value), &delivery); err == nil {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+// Build the jobs for one run: data-refreshed, one metric-failed per failed
+// metric and one alert-fired per alert, fanned out to subscribed webhooks
+func buildWebhookJobs(data CryptoDataResponse, alerts []Alert) []WebhookJob {
+	webhooks, err := listWebhooks()
+	if err != nil || len(webhooks) == 0 {
+		return nil
+	}
+
+	type pending struct {
+		event   string
+		payload interface{}
+	}
+
+	events := []pending{{
+		event: WebhookEventDataRefreshed,
+		payload: gin.H{
+			"timestamp":          data.Timestamp,
+			"total_metrics":      data.TotalMetrics,
+			"successful_fetches": data.FetchStats.SuccessfulFetches,
+			"failed_fetches":     data.FetchStats.FailedFetches,
+			"data_url":           "/api/crypto/data",
+		},
+	}}
+	for sortType, metricData := range data.AllMetrics {
+		if metricData.Success && !metricData.Stale {
+			continue
+		}
+		payload := gin.H{
+			"metric":    sortType,
+			"name":      metricData.Name,
+			"error":     metricData.Error,
+			"timestamp": data.Timestamp,
+			"stale":     metricData.Stale, // Still serving last good data
+		}
+		if metricData.Stale {
+			payload["updated_at"] = metricData.UpdatedAt
+		}
+		events = append(events, pending{event: WebhookEventMetricFailed, payload: payload})
+	}
+	for _, alert := range alerts {
+		events = append(events, pending{event: WebhookEventAlertFired, payload: alert})
+	}
+
+	var jobs []WebhookJob
+	for _, e := range events {
+		payload, err := json.Marshal(e.payload)
+		if err != nil {
+			log.Printf("❌ Failed to marshal %s payload: %v", e.event, err)
+			continue
+		}
+		for _, w := range webhooks {
+			if !w.subscribedTo(e.event) {
+				continue
+			}
+			jobs = append(jobs, WebhookJob{
+				WebhookID:  w.ID,
+				DeliveryID: "dlv_" + randomHex(8),
+				Event:      e.event,
+				Payload:    payload,
+			})
+		}
+	}
+	return jobs
+}
+
+// Queue webhook jobs as Inngest events so each delivery retries on its own
+func queueWebhookJobs(ctx context.Context, data CryptoDataResponse, alerts []Alert) (int, error) {
+	jobs, err := runStep(ctx, "build-webhook-jobs", func(ctx context.Context) ([]WebhookJob, error) {
+		return buildWebhookJobs(data, alerts), nil
+	})
+	if err != nil || len(jobs) == 0 {
+		return 0, err
+	}
+
+	// Outside Inngest, deliver in the background with our own retries
+	if isDirectExecution(ctx) {
+		for _, job := range jobs {
+			go deliverWebhookWithRetries(job)
+		}
+		return len(jobs), nil
+	}
+
+	events := make([]inngestgo.GenericEvent[WebhookJob], len(jobs))
+	for i, job := range jobs {
+		id := job.DeliveryID
+		events[i] = inngestgo.GenericEvent[WebhookJob]{ID: &id, Name: webhookDeliverEvent, Data: job}
+	}
+
+	if _, err := step.SendMany(ctx, "queue-webhooks", events); err != nil {
+		return 0, err
+	}
+	return len(jobs), nil
+}
+
+// Make one delivery attempt; a non-nil error means the attempt should be retried
+func deliverWebhook(ctx context.Context, job WebhookJob, attempt int) error {
+	w, exists := getWebhook(job.WebhookID)
+	if !exists {
+		log.Printf("ℹ️  Webhook %s no longer registered, dropping %s", job.WebhookID, job.DeliveryID)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(webhookEnvelope{ID: job.DeliveryID, Event: job.Event, Timestamp: now, Data: job.Payload})
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "crypto-rankings-webhooks/1.0")
+	req.Header.Set("X-Crypto-Event", job.Event)
+	req.Header.Set("X-Crypto-Delivery", job.DeliveryID)
+	req.Header.Set("X-Crypto-Timestamp", timestamp)
+	req.Header.Set("X-Crypto-Signature", signWebhookPayload(w.Secret, timestamp, body))
+
+	delivery := WebhookDelivery{DeliveryID: job.DeliveryID, Event: job.Event, Attempt: attempt, At: now}
+	startTime := time.Now()
+	resp, err := webhookHTTPClient.Do(req)
+	delivery.DurationMs = time.Since(startTime).Milliseconds()
+
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		resp.Body.Close()
+		delivery.StatusCode = resp.StatusCode
+		delivery.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+		if !delivery.Success {
+			delivery.Error = fmt.Sprintf("endpoint returned status %d", resp.StatusCode)
+		}
+	}
+	recordWebhookDelivery(w.ID, delivery)
+
+	if !delivery.Success {
+		log.Printf("⚠️  Webhook %s delivery %s attempt %d failed: %s", w.ID, job.DeliveryID, attempt, delivery.Error)
+		return fmt.Errorf("webhook %s: %s", w.ID, delivery.Error)
+	}
+
+	log.Printf("✅ Webhook %s delivered %s (%s) in %dms", w.ID, job.Event, job.DeliveryID, delivery.DurationMs)
+	return nil
+}
+
+// Standalone delivery: same attempts as the Inngest function, with backoff between them
+func deliverWebhookWithRetries(job WebhookJob) {
+	for attempt := 1; attempt <= webhookDeliveryRetries+1; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), webhookHTTPClient.Timeout+5*time.Second)
+		err := deliverWebhook(ctx, job, attempt)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt <= webhookDeliveryRetries {
+			time.Sleep(backoffDelay(attempt))
+		}
+	}
+	log.Printf("❌ Webhook %s delivery %s gave up after %d attempts", job.WebhookID, job.DeliveryID, webhookDeliveryRetries+1)
+}
+
+// Inngest function that delivers one queued webhook job. Failed attempts are
+// retried by Inngest with exponential backoff, so retries survive restarts.
+func createWebhookDeliveryFunction(client inngestgo.Client) (inngestgo.ServableFunction, error) {
+	return inngestgo.CreateFunction(
+		client,
+		inngestgo.FunctionOpts{
+			ID:      "deliver-webhook",
+			Retries: inngestgo.IntPtr(webhookDeliveryRetries),
+		},
+		inngestgo.EventTrigger(webhookDeliverEvent, nil),
+		func(ctx context.Context, input inngestgo.Input[WebhookJob]) (any, error) {
+			job := input.Event.Data
+			attempt := input.InputCtx.Attempt + 1
+
+			_, err := step.Run(ctx, "deliver", func(ctx context.Context) (string, error) {
+				return "delivered", deliverWebhook(ctx, job, attempt)
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return map[string]interface{}{
+				"webhook_id":  job.WebhookID,
+				"delivery_id": job.DeliveryID,
+				"event":       job.Event,
+				"status":      "delivered",
+			}, nil
+		},
+	)
+}
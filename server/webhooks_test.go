@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"event":"data-refreshed"}`)
+
+	// HMAC-SHA256("whsec_test", "1760572800." + body), computed independently
+	want := "sha256=02fbab27595884a7c6908b198880bca55f4d56299196f8d7d3018f18e87ebf3e"
+	if got := signWebhookPayload("whsec_test", "1760572800", body); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// Secret, timestamp and body are all covered
+	for name, got := range map[string]string{
+		"secret":    signWebhookPayload("whsec_other", "1760572800", body),
+		"timestamp": signWebhookPayload("whsec_test", "1760572801", body),
+		"body":      signWebhookPayload("whsec_test", "1760572800", []byte(`{"event":"alert-fired"}`)),
+	} {
+		if got == want {
+			t.Errorf("changing the %s didn't change the signature", name)
+		}
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	w := Webhook{URL: "https://203.0.113.10/hooks"}
+	if err := validateWebhook(&w); err != nil {
+		t.Fatalf("public URL rejected: %v", err)
+	}
+	if len(w.Events) != len(allWebhookEvents) {
+		t.Errorf("no events should subscribe to all, got %v", w.Events)
+	}
+
+	w = Webhook{URL: "https://203.0.113.10/hooks", Events: []string{WebhookEventAlertFired, "price-moved"}}
+	if err := validateWebhook(&w); err == nil || !strings.Contains(err.Error(), "price-moved") {
+		t.Errorf("unknown event: got %v, want an error naming it", err)
+	}
+}
+
+func TestValidateWebhookRejectsInternalDestinations(t *testing.T) {
+	for _, url := range []string{
+		"ftp://203.0.113.10/hooks",
+		"/hooks",
+		"http://localhost:8080/hooks",
+		"http://api.localhost/hooks",
+		"http://127.0.0.1/hooks",
+		"http://[::1]/hooks",
+		"http://0.0.0.0/hooks",
+		"http://10.0.0.5/hooks",
+		"http://172.16.3.4/hooks",
+		"http://192.168.1.1/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[fe80::1]/hooks",
+		"http://[fd00::1]/hooks",
+		"http://[::ffff:127.0.0.1]/hooks",
+	} {
+		w := Webhook{URL: url}
+		if err := validateWebhook(&w); err == nil {
+			t.Errorf("%s accepted, want an error", url)
+		}
+	}
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	// Checked at dial time too, so DNS that changes after registration can't reach inside
+	_, err := webhookHTTPClient.Get("http://127.0.0.1:1/")
+	if err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("got %v, want the dial to be refused", err)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/gin-gonic/gin"
+)
+
+// WebSocket protocol
+//
+//	→ {"action":"subscribe","topics":["metric:volume_24h","symbol:ETH","coin:1"]}
+//	→ {"action":"unsubscribe","topics":["coin:2"]}
+//	→ {"action":"ping"}
+//	← {"type":"subscribed","topics":[...]} / {"type":"unsubscribed",...} / {"type":"pong"}
+//	← {"type":"metric","topic":"metric:volume_24h","timestamp":...,"data":MetricData}
+//	← {"type":"symbol","topic":"coin:2","timestamp":...,"data":{"<metric>":SymbolMetricUpdate}}
+//	← {"type":"error","error":"..."}
+//
+// Coins are followed by ID. symbol:<SYMBOL> is only a lookup: it resolves to
+// the one coin with that symbol in the latest run, and the reply lists the
+// coin:<id> topic it became. Only changes are pushed: a metric topic fires
+// when that metric's ranking changed, a coin topic when the coin's entry
+// changed in any metric.
+const (
+	wsTopicMetricPrefix = "metric:"
+	wsTopicSymbolPrefix = "symbol:"
+	wsTopicCoinPrefix   = "coin:"
+	wsMaxTopics         = 50
+	wsOutboundBuffer    = 32
+	wsReadLimit         = 4096
+	wsPingInterval      = 30 * time.Second
+	wsWriteTimeout      = 10 * time.Second
+)
+
+type wsClientMessage struct {
+	Action string   `json:"action"`
+	Topics []string `json:"topics,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type      string      `json:"type"`
+	Topic     string      `json:"topic,omitempty"`
+	Topics    []string    `json:"topics,omitempty"`
+	Timestamp *time.Time  `json:"timestamp,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// SymbolMetricUpdate is one coin's new state in one metric. Entry is nil when
+// the coin dropped out of the ranking.
+type SymbolMetricUpdate struct {
+	Entry  *CryptoData `json:"entry"`
+	Change *RankChange `json:"change,omitempty"`
+}
+
+var errSlowConsumer = errors.New("slow consumer")
+
+// wsConn is one WebSocket client and its topic subscriptions
+type wsConn struct {
+	conn     *websocket.Conn
+	outbound chan wsServerMessage
+
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+// Queue a message without blocking; a full queue means the client can't keep up
+func (w *wsConn) send(msg wsServerMessage) error {
+	select {
+	case w.outbound <- msg:
+		return nil
+	default:
+		return errSlowConsumer
+	}
+}
+
+func (w *wsConn) subscribed() map[string]bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	topics := make(map[string]bool, len(w.topics))
+	for topic := range w.topics {
+		topics[topic] = true
+	}
+	return topics
+}
+
+// Normalize and validate a topic name
+func parseTopic(topic string) (string, error) {
+	topic = strings.TrimSpace(topic)
+	switch {
+	case strings.HasPrefix(topic, wsTopicMetricPrefix):
+		metric := strings.TrimPrefix(topic, wsTopicMetricPrefix)
+		if _, exists := sortableMetrics()[metric]; !exists {
+			return "", fmt.Errorf("unknown metric %q", metric)
+		}
+		return wsTopicMetricPrefix + metric, nil
+	case strings.HasPrefix(topic, wsTopicSymbolPrefix):
+		symbol := strings.TrimPrefix(topic, wsTopicSymbolPrefix)
+		if symbol == "" {
+			return "", fmt.Errorf("empty symbol in %q", topic)
+		}
+		id, _, err := resolveCoin(symbol)
+		if errors.Is(err, errCoinNotFound) {
+			return "", fmt.Errorf("unknown symbol %q", symbol)
+		}
+		if err != nil {
+			return "", err
+		}
+		return wsTopicCoinPrefix + strconv.Itoa(id), nil
+	case strings.HasPrefix(topic, wsTopicCoinPrefix):
+		id, err := strconv.Atoi(strings.TrimPrefix(topic, wsTopicCoinPrefix))
+		if err != nil || id <= 0 {
+			return "", fmt.Errorf("invalid coin ID in %q", topic)
+		}
+		return wsTopicCoinPrefix + strconv.Itoa(id), nil
+	}
+	return "", fmt.Errorf("invalid topic %q: use metric:<key>, coin:<id> or symbol:<SYMBOL>", topic)
+}
+
+func (w *wsConn) handleMessage(msg wsClientMessage) wsServerMessage {
+	switch msg.Action {
+	case "ping":
+		return wsServerMessage{Type: "pong"}
+
+	case "subscribe", "unsubscribe":
+		topics := make([]string, 0, len(msg.Topics))
+		for _, raw := range msg.Topics {
+			topic, err := parseTopic(raw)
+			if err != nil {
+				return wsServerMessage{Type: "error", Error: err.Error()}
+			}
+			topics = append(topics, topic)
+		}
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if msg.Action == "unsubscribe" {
+			for _, topic := range topics {
+				delete(w.topics, topic)
+			}
+			return wsServerMessage{Type: "unsubscribed", Topics: topics}
+		}
+
+		// Check the whole batch first, so a rejected subscribe changes nothing
+		added := make(map[string]bool, len(topics))
+		for _, topic := range topics {
+			if !w.topics[topic] {
+				added[topic] = true
+			}
+		}
+		if len(w.topics)+len(added) > wsMaxTopics {
+			return wsServerMessage{Type: "error", Error: fmt.Sprintf("at most %d topics per connection", wsMaxTopics)}
+		}
+		for topic := range added {
+			w.topics[topic] = true
+		}
+		return wsServerMessage{Type: "subscribed", Topics: topics}
+	}
+
+	return wsServerMessage{Type: "error", Error: fmt.Sprintf("unknown action %q", msg.Action)}
+}
+
+// Messages for one run, limited to the topics this client subscribed to
+func topicMessages(update StreamUpdate, topics map[string]bool) []wsServerMessage {
+	timestamp := update.Data.Timestamp
+	var messages []wsServerMessage
+
+	for _, sortType := range update.ChangedMetrics {
+		topic := wsTopicMetricPrefix + sortType
+		if topics[topic] {
+			messages = append(messages, wsServerMessage{
+				Type:      "metric",
+				Topic:     topic,
+				Timestamp: &timestamp,
+				Data:      update.Data.AllMetrics[sortType],
+			})
+		}
+	}
+
+	for topic := range topics {
+		id, err := strconv.Atoi(strings.TrimPrefix(topic, wsTopicCoinPrefix))
+		if !strings.HasPrefix(topic, wsTopicCoinPrefix) || err != nil {
+			continue
+		}
+		if changes := coinChanges(update, id); len(changes) > 0 {
+			messages = append(messages, wsServerMessage{
+				Type:      "symbol",
+				Topic:     topic,
+				Timestamp: &timestamp,
+				Data:      changes,
+			})
+		}
+	}
+
+	return messages
+}
+
+func findCoin(data []CryptoData, id int) *CryptoData {
+	for i := range data {
+		if data[i].ID == id {
+			return &data[i]
+		}
+	}
+	return nil
+}
+
+// Metrics where the coin's entry appeared, disappeared or changed value/rank
+func coinChanges(update StreamUpdate, id int) map[string]SymbolMetricUpdate {
+	changes := map[string]SymbolMetricUpdate{}
+	for _, sortType := range update.ChangedMetrics {
+		metricData := update.Data.AllMetrics[sortType]
+		current := findCoin(metricData.AllData, id)
+
+		var previous *CryptoData
+		if update.Previous != nil {
+			previous = findCoin(update.Previous.AllMetrics[sortType].AllData, id)
+		}
+
+		if current == nil && previous == nil {
+			continue
+		}
+		if current != nil && previous != nil && current.Value == previous.Value && current.Rank == previous.Rank {
+			continue
+		}
+
+		entry := SymbolMetricUpdate{Entry: current}
+		for i := range metricData.Changes {
+			if metricData.Changes[i].ID == id {
+				entry.Change = &metricData.Changes[i]
+				break
+			}
+		}
+		changes[sortType] = entry
+	}
+	return changes
+}
+
+// Same-host requests and clients without an Origin (non-browsers) are always
+// allowed; browsers from elsewhere must pass the CORS origin policy
+func websocketOriginAllowed(r *http.Request, policy *corsPolicy) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return policy.allows(origin)
+}
+
+// GET /api/crypto/ws: topic subscriptions over WebSocket
+func websocketHandler(policy *corsPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !websocketOriginAllowed(c.Request, policy) {
+			c.JSON(403, gin.H{"error": "Origin not allowed"})
+			return
+		}
+
+		// The origin was checked above, against globs and patterns the library can't express
+		conn, err := websocket.Accept(c.Writer, c.Request, &websocket.AcceptOptions{InsecureSkipVerify: true})
+		if err != nil {
+			log.Printf("⚠️  WebSocket upgrade failed: %v", err)
+			return
+		}
+		conn.SetReadLimit(wsReadLimit)
+
+		client := &wsConn{
+			conn:     conn,
+			outbound: make(chan wsServerMessage, wsOutboundBuffer),
+			topics:   map[string]bool{},
+		}
+		subscriber := hub.subscribe()
+		defer hub.unsubscribe(subscriber)
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+
+		// Writer: drains the outbound queue and sends heartbeats
+		go func() {
+			defer cancel()
+			ping := time.NewTicker(wsPingInterval)
+			defer ping.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-client.outbound:
+					writeCtx, done := context.WithTimeout(ctx, wsWriteTimeout)
+					err := wsjson.Write(writeCtx, conn, msg)
+					done()
+					if err != nil {
+						return
+					}
+				case <-ping.C:
+					pingCtx, done := context.WithTimeout(ctx, wsWriteTimeout)
+					err := conn.Ping(pingCtx)
+					done()
+					if err != nil {
+						log.Printf("⚠️  WebSocket heartbeat failed: %v", err)
+						return
+					}
+				}
+			}
+		}()
+
+		// Fan-out: turns hub updates into topic messages for this client
+		go func() {
+			defer cancel()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case update := <-subscriber.updates:
+					for _, msg := range topicMessages(update, client.subscribed()) {
+						if client.send(msg) != nil {
+							log.Printf("⚠️  Closing slow WebSocket client")
+							conn.Close(websocket.StatusPolicyViolation, "slow consumer")
+							return
+						}
+					}
+				}
+			}
+		}()
+
+		// Reader: handles subscribe/unsubscribe/ping until the client goes away
+		for {
+			var msg wsClientMessage
+			if err := wsjson.Read(ctx, conn, &msg); err != nil {
+				status := websocket.CloseStatus(err)
+				if status != websocket.StatusNormalClosure && status != websocket.StatusGoingAway && ctx.Err() == nil {
+					log.Printf("⚠️  WebSocket read failed: %v", err)
+				}
+				conn.Close(websocket.StatusNormalClosure, "")
+				return
+			}
+			if client.send(client.handleMessage(msg)) != nil {
+				conn.Close(websocket.StatusPolicyViolation, "slow consumer")
+				return
+			}
+		}
+	}
+}
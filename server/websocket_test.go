@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSubscribeBatchOverLimitChangesNothing(t *testing.T) {
+	client := &wsConn{topics: map[string]bool{}}
+
+	first := make([]string, wsMaxTopics-1)
+	for i := range first {
+		first[i] = fmt.Sprintf("coin:%d", i+1)
+	}
+	if reply := client.handleMessage(wsClientMessage{Action: "subscribe", Topics: first}); reply.Type != "subscribed" {
+		t.Fatalf("first batch: got %+v, want subscribed", reply)
+	}
+
+	// Re-subscribing to a held topic is free; two new ones go over the limit
+	batch := []string{"coin:1", "coin:1001", "coin:1002"}
+	if reply := client.handleMessage(wsClientMessage{Action: "subscribe", Topics: batch}); reply.Type != "error" {
+		t.Fatalf("over-limit batch: got %+v, want error", reply)
+	}
+	if topics := client.subscribed(); len(topics) != wsMaxTopics-1 || topics["coin:1001"] {
+		t.Errorf("rejected batch was partly applied: %d topics", len(topics))
+	}
+
+	if reply := client.handleMessage(wsClientMessage{Action: "subscribe", Topics: batch[:2]}); reply.Type != "subscribed" {
+		t.Errorf("batch that fits: got %+v, want subscribed", reply)
+	}
+}
+
+func TestSymbolTopicResolvesToOneCoin(t *testing.T) {
+	store = newFailoverStore(nil)
+	latest := CryptoDataResponse{Timestamp: time.Now(), AllMetrics: map[string]MetricData{
+		"price": {Success: true, AllData: []CryptoData{{ID: 1, Symbol: "BTC"}, {ID: 10, Symbol: "DUP"}, {ID: 20, Symbol: "DUP"}}},
+	}}
+	if !storeLatestDataInRedis(latest) {
+		t.Fatal("failed to store latest data")
+	}
+
+	if topic, err := parseTopic("symbol:btc"); err != nil || topic != "coin:1" {
+		t.Errorf("symbol:btc: %q, %v, want coin:1", topic, err)
+	}
+	for _, topic := range []string{"symbol:DUP", "symbol:NOPE", "coin:x", "coin:0"} {
+		if _, err := parseTopic(topic); err == nil {
+			t.Errorf("%s accepted, want an error", topic)
+		}
+	}
+}
+
+func TestCoinTopicFollowsTheID(t *testing.T) {
+	price := func(v string, rank int, id int) CryptoData {
+		return CryptoData{ID: id, Symbol: "DUP", Value: v, Rank: rank}
+	}
+	previous := CryptoDataResponse{AllMetrics: map[string]MetricData{
+		"price": {Success: true, AllData: []CryptoData{price("$2", 1, 10), price("$1", 2, 20)}},
+	}}
+	update := StreamUpdate{
+		Data: CryptoDataResponse{AllMetrics: map[string]MetricData{
+			"price": {Success: true, AllData: []CryptoData{price("$2", 1, 10), price("$3", 2, 20)}},
+		}},
+		Previous:       &previous,
+		ChangedMetrics: []string{"price"},
+	}
+
+	// Coin 10 shares the symbol but didn't change
+	messages := topicMessages(update, map[string]bool{"coin:10": true, "coin:20": true})
+	if len(messages) != 1 || messages[0].Topic != "coin:20" {
+		t.Fatalf("got %+v, want one message for coin:20", messages)
+	}
+	entry := messages[0].Data.(map[string]SymbolMetricUpdate)["price"].Entry
+	if entry == nil || entry.ID != 20 || entry.Value != "$3" {
+		t.Errorf("coin:20 entry %+v, want its new price", entry)
+	}
+}